@@ -0,0 +1,88 @@
+package configsync
+
+import (
+	"fmt"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
+const (
+	// GitBackendExec run the git binary for every operation. This is the default.
+	GitBackendExec = "exec"
+	// GitBackendNative use the git implementation built in to configsync, which needs no git binary but does not
+	// support remotes or signing. Use GitBackendExec to pull and push.
+	GitBackendNative = "native"
+)
+
+// backend get the name of the git backend
+func (o GitOptionsType) backend() string {
+	if o.Backend == "" {
+		return GitBackendExec
+	}
+	return o.Backend
+}
+
+// author get the author of commits and tags, defaulting to configsync at the hostname of the system
+func (o GitOptionsType) author() string {
+	if o.Author == "" {
+		return "configsync <configsync@" + getHostname() + ">"
+	}
+	return o.Author
+}
+
+// hostRevision get the revision to use, defaulting to the host branch if revision is empty
+func (o GitOptionsType) hostRevision(revision string) string {
+	if revision != "" {
+		return revision
+	}
+	if o.BranchName != "" {
+		return o.BranchName
+	}
+	return defaultBranchName()
+}
+
+// openGit open the repository for the work directory using the configured backend, applying the signing options. If
+// repo is not nil it is used instead of opening a new repository.
+func (o GitOptionsType) openGit(workDir string, repo git.Repository) (git.Repository, error) {
+	switch o.VerifySignatures {
+	case "", SignatureVerifyNone, SignatureVerifyWarn, SignatureVerifyRequire:
+	default:
+		return nil, fmt.Errorf("invalid signature verification mode '%s'", o.VerifySignatures)
+	}
+	if o.SigningFormat == "" && (o.SigningKey != "" || o.verifySignatures()) {
+		return nil, fmt.Errorf("a signing format is required to sign commits or verify signatures")
+	}
+
+	if repo == nil {
+		switch o.backend() {
+		case GitBackendExec:
+			g, err := git.New(o.Path, workDir)
+			if err != nil {
+				return nil, err
+			}
+			repo = g
+		case GitBackendNative:
+			if o.RemoteEnabled {
+				return nil, fmt.Errorf("%w: the native git backend does not support remotes, use the exec backend", git.ErrUnsupported)
+			}
+			repo = git.NewNative(workDir)
+		default:
+			return nil, fmt.Errorf("invalid git backend '%s'", o.Backend)
+		}
+	}
+
+	if o.SigningFormat != "" {
+		signer, ok := repo.(git.Signer)
+		if !ok {
+			return nil, fmt.Errorf("the %s git backend does not support signing", o.backend())
+		}
+		if err := signer.SetSigning(git.SigningOptions{
+			Format:             o.SigningFormat,
+			Key:                o.SigningKey,
+			AllowedSignersFile: o.AllowedSignersFile,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return repo, nil
+}
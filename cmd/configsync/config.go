@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ecnepsnai/configsync"
+	"github.com/ecnepsnai/logtic"
+	"github.com/pelletier/go-toml"
+)
+
+const defaultConfigPath = "configsync.conf"
+
+// loadConfig read and validate the config file at configPath and prepare logging. Exits the process if the config is
+// invalid.
+func loadConfig(configPath string) configSyncOptionsType {
+	f, err := os.Open(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Config file not found at path '%s'\n", configPath)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Unable to read config file at '%s': %s\n", configPath, err.Error())
+		os.Exit(1)
+	}
+	defer f.Close()
+	config := configSyncOptionsType{}
+	if err := toml.NewDecoder(f).Decode(&config); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read config file at '%s': %s\n", configPath, err.Error())
+		os.Exit(1)
+	}
+	config.ConfigFilePath = configPath
+
+	if config.Workdir == "" {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: Workdir is required\n")
+		os.Exit(1)
+	}
+
+	if config.Git.Path == "" && config.Git.Backend != configsync.GitBackendNative {
+		gitPath, err := exec.LookPath("git")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Git binary not specified and not found anywhere on $PATH\n")
+			os.Exit(1)
+		}
+		config.Git.Path = gitPath
+	}
+
+	if config.Verbose {
+		logtic.Log.Level = logtic.LevelDebug
+	} else {
+		logtic.Log.Level = logtic.LevelWarn
+	}
+	logtic.Log.Open()
+
+	config.readIncludeFiles()
+	return config
+}
+
+type configSyncOptionsType struct {
+	ConfInclude string                     `toml:"conf_include"`
+	Workdir     string                     `toml:"workdir"`
+	Git         configsync.GitOptionsType  `toml:"git"`
+	Walk        configsync.WalkOptionsType `toml:"walk"`
+	// Path to a file containing the key used to hash redacted secrets
+	RedactionKeyFile string `toml:"redaction_key_file"`
+	// Path to a file containing the key used to encrypt sensitive files
+	EncryptionKeyFile string `toml:"encryption_key_file"`
+	Verbose           bool   `toml:"verbose"`
+
+	// Populated at runtime with the absolute path to the original config file
+	ConfigFilePath string `toml:"-"`
+
+	// Populated at runtime with the parsed include files, so that each file is only read once
+	fileLists    []fileListT
+	ignoreLines  []string
+	encryptLines []string
+	commandFiles []commandFileT
+}
+
+type fileListT struct {
+	IncludeFile string
+	Lines       []string
+}
+
+// readIncludeFiles read and parse the file list, ignore, encrypt, and command include files
+func (c *configSyncOptionsType) readIncludeFiles() {
+	c.fileLists = []fileListT{}
+	for _, includeFile := range c.includeFilesWithExtension(".files") {
+		c.fileLists = append(c.fileLists, fileListT{
+			IncludeFile: includeFile,
+			Lines:       c.readIncludeFile(includeFile),
+		})
+	}
+	c.ignoreLines = c.includeFileLines(".ignore")
+	c.encryptLines = c.includeFileLines(".encrypt")
+	c.commandFiles = c.readCommandFiles()
+}
+
+func (c configSyncOptionsType) options() configsync.Options {
+	return configsync.Options{
+		WorkDir:         c.Workdir,
+		FilePatterns:    c.filePatterns(),
+		ExcludePatterns: c.excludePatterns(),
+		Walk:            c.Walk,
+		Commands:        c.commands(),
+		Git:             c.Git,
+		SourceGroups:    c.sourceGroups(),
+		Redaction: configsync.RedactionOptionsType{
+			Key:   c.redactionKey(),
+			Rules: c.redactionRules(),
+		},
+		Encryption: configsync.EncryptionOptionsType{
+			Key:      c.encryptionKey(),
+			Patterns: c.encryptLines,
+		},
+	}
+}
+
+func (c configSyncOptionsType) encryptionKey() []byte {
+	if c.EncryptionKeyFile == "" {
+		return nil
+	}
+	key, err := os.ReadFile(c.EncryptionKeyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read encryption key file at '%s': %s\n", c.EncryptionKeyFile, err.Error())
+		os.Exit(1)
+	}
+	return key
+}
+
+func (c configSyncOptionsType) redactionKey() []byte {
+	if c.RedactionKeyFile == "" {
+		return nil
+	}
+	key, err := os.ReadFile(c.RedactionKeyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read redaction key file at '%s': %s\n", c.RedactionKeyFile, err.Error())
+		os.Exit(1)
+	}
+	return bytes.TrimSpace(key)
+}
+
+// redactionRules read all redaction rules. Unlike other include files, an invalid redaction file is fatal so that
+// secrets are never synced by mistake.
+func (c configSyncOptionsType) redactionRules() []configsync.RedactionRuleType {
+	rules := []configsync.RedactionRuleType{}
+
+	for _, includeFile := range c.includeFilesWithExtension(".redact") {
+		f, err := os.OpenFile(path.Join(c.includeDir(), includeFile), os.O_RDONLY, os.ModePerm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read redaction file %s: %s\n", includeFile, err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+		rule := configsync.RedactionRuleType{}
+		if err := toml.NewDecoder(f).Decode(&rule); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read redaction file %s: %s\n", includeFile, err.Error())
+			os.Exit(1)
+		}
+		if len(rule.Patterns) == 0 {
+			fmt.Fprintf(os.Stderr, "Invalid redaction file %s: Empty or missing patterns property\n", includeFile)
+			os.Exit(1)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+func (c configSyncOptionsType) includeDir() string {
+	if filepath.IsAbs(c.ConfInclude) {
+		return c.ConfInclude
+	}
+	return path.Join(filepath.Dir(c.ConfigFilePath), c.ConfInclude)
+}
+
+func (c configSyncOptionsType) includeFilesWithExtension(ext string) []string {
+	incFiles := []string{}
+	files, _ := os.ReadDir(c.includeDir())
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ext) {
+			incFiles = append(incFiles, file.Name())
+		}
+	}
+
+	return incFiles
+}
+
+// includeFileLines read all lines from include files with the given extension, skipping empty lines and comments
+func (c configSyncOptionsType) includeFileLines(ext string) []string {
+	lines := []string{}
+	for _, includeFile := range c.includeFilesWithExtension(ext) {
+		lines = append(lines, c.readIncludeFile(includeFile)...)
+	}
+	return lines
+}
+
+// readIncludeFile read all lines from the include file, skipping empty lines and comments
+func (c configSyncOptionsType) readIncludeFile(includeFile string) []string {
+	lines := []string{}
+
+	f, err := os.OpenFile(path.Join(c.includeDir(), includeFile), os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		log.Error("Error opening file %s: %s", includeFile, err.Error())
+		return lines
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (c configSyncOptionsType) filePatterns() []string {
+	patterns := []string{}
+	for _, fileList := range c.fileLists {
+		for _, line := range fileList.Lines {
+			if line[0] == '!' {
+				continue
+			}
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
+
+// excludePatterns get all negated patterns from file lists and all patterns from ignore files
+func (c configSyncOptionsType) excludePatterns() []string {
+	patterns := []string{}
+	for _, fileList := range c.fileLists {
+		for _, line := range fileList.Lines {
+			if line[0] == '!' && len(line) > 1 {
+				patterns = append(patterns, line[1:])
+			}
+		}
+	}
+	patterns = append(patterns, c.ignoreLines...)
+	return patterns
+}
+
+func (c configSyncOptionsType) commands() []configsync.CommandType {
+	commands := []configsync.CommandType{}
+	for _, commandFile := range c.commandFiles {
+		commands = append(commands, commandFile.Command)
+	}
+	return commands
+}
+
+type commandFileT struct {
+	IncludeFile string
+	Command     configsync.CommandType
+}
+
+// readCommandFiles read all valid commands and the include file they were defined in
+func (c configSyncOptionsType) readCommandFiles() []commandFileT {
+	commands := []commandFileT{}
+
+	for _, includeFile := range c.includeFilesWithExtension(".cmd") {
+		f, err := os.OpenFile(path.Join(c.includeDir(), includeFile), os.O_RDONLY, os.ModePerm)
+		if err != nil {
+			log.Error("Error opening file %s: %s", includeFile, err.Error())
+			continue
+		}
+		defer f.Close()
+		command := configsync.CommandType{}
+		if err := toml.NewDecoder(f).Decode(&command); err != nil {
+			log.Error("Error decoding command file %s: %s", includeFile, err.Error())
+			continue
+		}
+		if command.ExePath == "" && command.Shell == "" {
+			log.Error("Invalid command file %s: Empty or missing exe_path or shell property", includeFile)
+			continue
+		}
+		if command.ExePath != "" && command.Shell != "" {
+			log.Error("Invalid command file %s: Only one of exe_path or shell may be specified", includeFile)
+			continue
+		}
+		if command.FilePath == "" {
+			log.Error("Invalid command file %s: Empty or missing file_path property", includeFile)
+			continue
+		}
+		commands = append(commands, commandFileT{
+			IncludeFile: includeFile,
+			Command:     command,
+		})
+	}
+
+	return commands
+}
+
+// sourceGroups map each file pattern and command to the name of the include file it was defined in
+func (c configSyncOptionsType) sourceGroups() map[string]string {
+	groups := map[string]string{}
+	for _, fileList := range c.fileLists {
+		for _, line := range fileList.Lines {
+			if line[0] != '!' {
+				groups[line] = fileList.IncludeFile
+			}
+		}
+	}
+	for _, commandFile := range c.commandFiles {
+		groups[commandFile.Command.FilePath] = commandFile.IncludeFile
+	}
+	return groups
+}
@@ -1,174 +1,159 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
-	"strings"
+	"os/signal"
+	"syscall"
 
 	"github.com/ecnepsnai/configsync"
 	"github.com/ecnepsnai/logtic"
-	"github.com/pelletier/go-toml"
 )
 
 var log = logtic.Log.Connect("configsync")
 
+// reasonEnvironmentVariable is the environment variable used for the reason of the sync if --message isn't specified
+const reasonEnvironmentVariable = "CONFIGSYNC_REASON"
+
 func printHelpAndExit() {
-	fmt.Fprintf(os.Stderr, "Usage %s [Override config path]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage %s [--dry-run] [--message reason] [--tag name] [Override config path]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  --dry-run  Show what would be synced without changing the work directory\n")
+	fmt.Fprintf(os.Stderr, "  --message  Reason for the sync, such as a ticket number, used as the commit subject.\n")
+	fmt.Fprintf(os.Stderr, "             Defaults to $%s\n", reasonEnvironmentVariable)
+	fmt.Fprintf(os.Stderr, "  --tag      Make an annotated tag of the synced commit, such as pre-upgrade-2026-10-18\n")
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  restore [--config path] [--rev commit] [--root dir] [--no-backup] [paths...]\n")
+	fmt.Fprintf(os.Stderr, "    Restore synced files back onto the system\n")
+	fmt.Fprintf(os.Stderr, "  diff|drift [--config path] [--rev commit]\n")
+	fmt.Fprintf(os.Stderr, "    Compare the system against the last synced snapshot. Exits 0 if unchanged, 2 if changed, 1 on error\n")
+	fmt.Fprintf(os.Stderr, "  verify [--config path] [--rev commit]\n")
+	fmt.Fprintf(os.Stderr, "    Check the signature of every synced commit. Exits 0 if all are valid, 2 if any are not, 1 on error\n")
+	fmt.Fprintf(os.Stderr, "  tag [--config path] [-m message] [--rev commit] [name]\n")
+	fmt.Fprintf(os.Stderr, "    Make an annotated tag of a synced commit, or list tags if no name is given\n")
+	fmt.Fprintf(os.Stderr, "  log [--config path] [--rev commit] <path>\n")
+	fmt.Fprintf(os.Stderr, "    List the commits that changed a synced file\n")
+	fmt.Fprintf(os.Stderr, "  show [--config path] [--rev commit | --at timestamp] <path>\n")
+	fmt.Fprintf(os.Stderr, "    Print a synced file as it was at a commit or point in time\n")
 	os.Exit(1)
 }
 
 func main() {
 	args := os.Args
 	if len(args) >= 2 {
-		if args[1] == "-h" || args[1] == "--help" {
+		switch args[1] {
+		case "-h", "--help":
 			printHelpAndExit()
-		}
-		if args[1] == "-v" || args[1] == "--version" {
+		case "-v", "--version":
 			fmt.Printf("configsync v%s built on %s\n", Version, BuildDate)
 			os.Exit(0)
+		case "restore":
+			restoreCommand(args[2:])
+			return
+		case "diff", "drift":
+			driftCommand(args[2:])
+			return
+		case "verify":
+			verifyCommand(args[2:])
+			return
+		case "tag":
+			tagCommand(args[2:])
+			return
+		case "log":
+			logCommand(args[2:])
+			return
+		case "show":
+			showCommand(args[2:])
+			return
 		}
 	}
 
-	configPath := "configsync.conf"
-	if len(args) == 2 {
-		configPath = os.Args[1]
-	}
-
-	f, err := os.Open(configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "Config file not found at path '%s'\n", configPath)
-			os.Exit(1)
-		}
-		fmt.Fprintf(os.Stderr, "Unable to read config file at '%s': %s\n", configPath, err.Error())
-		os.Exit(1)
+	flags := flag.NewFlagSet("configsync", flag.ContinueOnError)
+	flags.Usage = printHelpAndExit
+	dryRun := flags.Bool("dry-run", false, "Show what would be synced without changing the work directory")
+	message := flags.String("message", os.Getenv(reasonEnvironmentVariable), "Reason for the sync, used as the commit subject")
+	tag := flags.String("tag", "", "Make an annotated tag of the synced commit")
+	positional := parseArgs(flags, args[1:])
+	if len(positional) > 1 {
+		printHelpAndExit()
 	}
-	defer f.Close()
-	config := configSyncOptionsType{}
-	if err := toml.NewDecoder(f).Decode(&config); err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to read config file at '%s': %s\n", configPath, err.Error())
-		os.Exit(1)
+	configPath := defaultConfigPath
+	if len(positional) == 1 {
+		configPath = positional[0]
 	}
-	config.ConfigFilePath = configPath
 
-	if config.Workdir == "" {
-		fmt.Fprintf(os.Stderr, "Invalid configuration: Workdir is required\n")
-		os.Exit(1)
-	}
+	config := loadConfig(configPath)
 
 	if len(config.commands()) == 0 && len(config.filePatterns()) == 0 {
 		fmt.Fprintf(os.Stderr, "Invalid configuration: At least one file or command is required\n")
 		os.Exit(1)
 	}
 
-	if config.Git.RemoteEnabled && config.Git.RemoteName == "" {
-		fmt.Fprintf(os.Stderr, "Invalid configuration: Remote name is required if git remote is enabled\n")
-		os.Exit(1)
-	}
-
-	if config.Git.Path == "" {
-		gitPath, err := exec.LookPath("git")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Git binary not specified and not found anywhere on $PATH\n")
-			os.Exit(1)
-		}
-		config.Git.Path = gitPath
-	}
+	ctx, cancel := signalContext()
+	defer cancel()
 
-	if config.Verbose {
-		logtic.Log.Level = logtic.LevelDebug
-	} else {
-		logtic.Log.Level = logtic.LevelWarn
+	if *dryRun {
+		printPlanAndExit(ctx, config)
 	}
-	logtic.Log.Open()
-
-	configsync.Start(config.Workdir, config.filePatterns(), config.commands(), config.Git)
-}
-
-type configSyncOptionsType struct {
-	ConfInclude string                    `toml:"conf_include"`
-	Workdir     string                    `toml:"workdir"`
-	Git         configsync.GitOptionsType `toml:"git"`
-	Verbose     bool                      `toml:"verbose"`
-
-	// Populated at runtime with the absolute path to the original config file
-	ConfigFilePath string `toml:"-"`
-}
 
-func (c configSyncOptionsType) includeDir() string {
-	if filepath.IsAbs(c.ConfInclude) {
-		return c.ConfInclude
+	options := config.options()
+	options.Reason = *message
+	options.Tag = *tag
+	options.Version = Version
+	if _, err := configsync.Run(ctx, options); err != nil {
+		log.Error("%s", err.Error())
+		cancel()
+		os.Exit(1)
 	}
-	return path.Join(filepath.Dir(c.ConfigFilePath), c.ConfInclude)
 }
 
-func (c configSyncOptionsType) includeFilesWithExtension(ext string) []string {
-	incFiles := []string{}
-	files, _ := os.ReadDir(c.includeDir())
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ext) {
-			incFiles = append(incFiles, file.Name())
-		}
-	}
-
-	return incFiles
+// signalContext return a context that is cancelled when configsync receives SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 }
 
-func (c configSyncOptionsType) filePatterns() []string {
-	patterns := []string{}
-
-	for _, includeFile := range c.includeFilesWithExtension(".files") {
-		f, err := os.OpenFile(path.Join(c.includeDir(), includeFile), os.O_RDONLY, os.ModePerm)
-		if err != nil {
-			log.Error("Error opening file %s: %s", includeFile, err.Error())
-			continue
+// parseArgs parse the flags in args, allowing flags to be mixed with positional arguments. Returns the positional
+// arguments. Prints the usage and exits if the flags are invalid.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			printHelpAndExit()
 		}
-		defer f.Close()
-		data, _ := io.ReadAll(f)
-
-		for _, line := range strings.Split(string(data), "\n") {
-			if line == "" {
-				continue
-			}
-			if line[0] == '#' {
-				continue
-			}
-			patterns = append(patterns, line)
+		args = flags.Args()
+		if len(args) == 0 {
+			break
 		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
-
-	return patterns
+	return positional
 }
 
-func (c configSyncOptionsType) commands() []configsync.CommandType {
-	commands := []configsync.CommandType{}
-
-	for _, includeFile := range c.includeFilesWithExtension(".cmd") {
-		f, err := os.OpenFile(path.Join(c.includeDir(), includeFile), os.O_RDONLY, os.ModePerm)
-		if err != nil {
-			log.Error("Error opening file %s: %s", includeFile, err.Error())
-			continue
-		}
-		defer f.Close()
-		command := configsync.CommandType{}
-		if err := toml.NewDecoder(f).Decode(&command); err != nil {
-			log.Error("Error decoding command file %s: %s", includeFile, err.Error())
-			continue
-		}
-		if command.ExePath == "" {
-			log.Error("Invalid command file %s: Empty or missing exe_path property", includeFile)
-			continue
-		}
-		if command.FilePath == "" {
-			log.Error("Invalid command file %s: Empty or missing file_path property", includeFile)
-			continue
-		}
-		commands = append(commands, command)
+func printPlanAndExit(ctx context.Context, config configSyncOptionsType) {
+	plan, err := configsync.Plan(ctx, config.options())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning sync: %s\n", err.Error())
+		os.Exit(1)
 	}
 
-	return commands
+	for _, filePath := range plan.Add {
+		fmt.Printf("+ %s\n", filePath)
+	}
+	for _, filePath := range plan.Modify {
+		fmt.Printf("~ %s\n", filePath)
+	}
+	for _, filePath := range plan.Remove {
+		fmt.Printf("- %s\n", filePath)
+	}
+	for _, filePath := range plan.Commands {
+		fmt.Printf("! %s\n", filePath)
+	}
+	for _, failure := range plan.Failed {
+		fmt.Printf("? %s: %s\n", failure.Path, failure.Error.Error())
+	}
+	fmt.Printf("Plan: %d to add, %d to modify, %d to remove, %d unchanged, %d commands to run\n", len(plan.Add), len(plan.Modify), len(plan.Remove), len(plan.Unchanged), len(plan.Commands))
+	os.Exit(0)
 }
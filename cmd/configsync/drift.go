@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ecnepsnai/configsync"
+)
+
+const (
+	driftExitNone  = 0
+	driftExitError = 1
+	driftExitFound = 2
+)
+
+func driftCommand(args []string) {
+	flags := flag.NewFlagSet("drift", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to the configsync config file")
+	revision := flags.String("rev", "", "Commit, branch, or tag to compare against. Defaults to the host branch")
+	parseArgs(flags, args)
+
+	config := loadConfig(*configPath)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	report, err := configsync.Drift(ctx, configsync.DriftOptions{
+		Options:  config.options(),
+		Revision: *revision,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking for drift: %s\n", err.Error())
+		os.Exit(driftExitError)
+	}
+
+	fmt.Print(report.Diff)
+	for _, failure := range report.Failed {
+		fmt.Fprintf(os.Stderr, "Error checking %s: %s\n", failure.Path, failure.Error.Error())
+	}
+
+	if report.HasDrift() {
+		fmt.Fprintf(os.Stderr, "Drift detected from %s: %d added, %d modified, %d removed\n", report.Revision, len(report.Added), len(report.Modified), len(report.Removed))
+		os.Exit(driftExitFound)
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(driftExitError)
+	}
+	os.Exit(driftExitNone)
+}
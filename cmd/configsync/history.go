@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ecnepsnai/configsync"
+)
+
+// timestampLayouts are the formats accepted by --at, in the local time zone unless one is given
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp '%s', expected a format like '2006-01-02 15:04:05'", value)
+}
+
+func logCommand(args []string) {
+	flags := flag.NewFlagSet("log", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to the configsync config file")
+	revision := flags.String("rev", "", "Commit, branch, or tag to start from. Defaults to the host branch")
+	paths := parseArgs(flags, args)
+	if len(paths) != 1 {
+		printHelpAndExit()
+	}
+
+	config := loadConfig(*configPath)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	commits, err := configsync.Log(ctx, configsync.HistoryOptions{
+		WorkDir:  config.Workdir,
+		Git:      config.Git,
+		Path:     paths[0],
+		Revision: *revision,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting history: %s\n", err.Error())
+		os.Exit(1)
+	}
+	for _, commit := range commits {
+		fmt.Printf("%s %s %s %s\n", commit.Hash, commit.Time.Format("2006-01-02 15:04:05"), commit.Author, commit.Subject)
+	}
+}
+
+func showCommand(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to the configsync config file")
+	revision := flags.String("rev", "", "Commit, branch, or tag to show the file at. Defaults to the host branch")
+	at := flags.String("at", "", "Show the file as it was at this time, such as '2026-10-13 09:00'")
+	paths := parseArgs(flags, args)
+	if len(paths) != 1 {
+		printHelpAndExit()
+	}
+	if *revision != "" && *at != "" {
+		fmt.Fprintf(os.Stderr, "Only one of --rev or --at can be specified\n")
+		os.Exit(1)
+	}
+	var timestamp time.Time
+	if *at != "" {
+		t, err := parseTimestamp(*at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+		timestamp = t
+	}
+
+	config := loadConfig(*configPath)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	report, err := configsync.Show(ctx, configsync.HistoryOptions{
+		WorkDir:       config.Workdir,
+		Git:           config.Git,
+		Path:          paths[0],
+		Revision:      *revision,
+		At:            timestamp,
+		EncryptionKey: config.encryptionKey(),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error showing file: %s\n", err.Error())
+		os.Exit(1)
+	}
+	os.Stdout.Write(report.Data)
+}
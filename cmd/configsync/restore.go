@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ecnepsnai/configsync"
+)
+
+func restoreCommand(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to the configsync config file")
+	revision := flags.String("rev", "", "Commit, branch, or tag to restore from. Defaults to the work directory")
+	root := flags.String("root", "", "Alternate root directory to restore files into")
+	noBackup := flags.Bool("no-backup", false, "Don't back up files that are overwritten")
+	paths := parseArgs(flags, args)
+
+	config := loadConfig(*configPath)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	report, err := configsync.Restore(ctx, configsync.RestoreOptions{
+		WorkDir:       config.Workdir,
+		Git:           config.Git,
+		Paths:         paths,
+		Revision:      *revision,
+		Root:          *root,
+		NoBackup:      *noBackup,
+		EncryptionKey: config.encryptionKey(),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error restoring files: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if report.SignatureWarning != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", report.SignatureWarning.Error())
+	}
+	for _, filePath := range report.Restored {
+		fmt.Printf("Restored %s\n", filePath)
+	}
+	for _, backupPath := range report.Backups {
+		fmt.Printf("Backed up %s\n", backupPath)
+	}
+	for _, failure := range report.Failed {
+		fmt.Fprintf(os.Stderr, "Error restoring %s: %s\n", failure.Path, failure.Error.Error())
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
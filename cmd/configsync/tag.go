@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ecnepsnai/configsync"
+)
+
+func tagCommand(args []string) {
+	flags := flag.NewFlagSet("tag", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to the configsync config file")
+	message := flags.String("m", "", "Message of the tag. Defaults to the name of the tag")
+	revision := flags.String("rev", "", "Commit, branch, or tag to tag. Defaults to the host branch")
+	names := parseArgs(flags, args)
+	if len(names) > 1 {
+		printHelpAndExit()
+	}
+
+	config := loadConfig(*configPath)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if len(names) == 0 {
+		tags, err := configsync.ListTags(ctx, config.Workdir, config.Git)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing tags: %s\n", err.Error())
+			os.Exit(1)
+		}
+		for _, tag := range tags {
+			fmt.Printf("%s %s %s %s\n", tag.Name, tag.Commit, tag.Time.Format("2006-01-02 15:04:05"), tag.Subject)
+		}
+		return
+	}
+
+	report, err := configsync.Tag(ctx, configsync.TagOptions{
+		WorkDir:  config.Workdir,
+		Git:      config.Git,
+		Name:     names[0],
+		Message:  *message,
+		Revision: *revision,
+	})
+	if report != nil {
+		fmt.Printf("Tagged %s as %s\n", report.Commit, report.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error tagging commit: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ecnepsnai/configsync"
+)
+
+const (
+	verifyExitValid   = 0
+	verifyExitError   = 1
+	verifyExitInvalid = 2
+)
+
+func verifyCommand(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to the configsync config file")
+	revision := flags.String("rev", "", "Commit, branch, or tag to verify. Defaults to the host branch")
+	parseArgs(flags, args)
+
+	config := loadConfig(*configPath)
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	report, err := configsync.Verify(ctx, configsync.VerifyOptions{
+		WorkDir:  config.Workdir,
+		Git:      config.Git,
+		Revision: *revision,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying commits: %s\n", err.Error())
+		os.Exit(verifyExitError)
+	}
+
+	invalid := 0
+	for _, commit := range report.Commits {
+		if commit.Error != nil {
+			invalid++
+			fmt.Printf("! %s %s\n", commit.Hash, commit.Error.Error())
+			continue
+		}
+		fmt.Printf("  %s %s\n", commit.Hash, commit.Signer)
+	}
+
+	if report.HasInvalid() {
+		fmt.Fprintf(os.Stderr, "%d of %d commits in %s are unsigned or badly signed\n", invalid, len(report.Commits), report.Revision)
+		os.Exit(verifyExitInvalid)
+	}
+	os.Exit(verifyExitValid)
+}
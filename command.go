@@ -0,0 +1,250 @@
+package configsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrCommandTimeout is returned when a command does not finish within its timeout
+var ErrCommandTimeout = errors.New("command timed out")
+
+// commandWaitDelay is how long to wait for the output of a killed command to be closed
+const commandWaitDelay = 5 * time.Second
+
+const (
+	// CommandOutputStdout capture only standard output. This is the default.
+	CommandOutputStdout = "stdout"
+	// CommandOutputCombined capture standard output and standard error interleaved into the same file
+	CommandOutputCombined = "combined"
+	// CommandOutputSeparate capture standard output and write standard error to a separate file
+	CommandOutputSeparate = "separate"
+)
+
+const (
+	// CommandExitPolicyFail treat a non-zero exit status as a failure and keep the previous output. This is the default.
+	CommandExitPolicyFail = "fail"
+	// CommandExitPolicySnapshot treat the output of a command that exits with a non-zero status as a valid snapshot
+	CommandExitPolicySnapshot = "snapshot"
+)
+
+// commandResultT describes the result of running a command
+type commandResultT struct {
+	// Standard output, or the combined output if the output mode is combined
+	Output []byte
+	// Standard error, only if the output mode is separate
+	Stderr   []byte
+	ExitCode int
+	Duration time.Duration
+	// The user and groups the command ran as, or nil if it ran as the current user
+	Credential *commandCredentialT
+}
+
+// commandOutputT describes an output file of a command
+type commandOutputT struct {
+	FilePath string
+	Data     []byte
+}
+
+// stderrFilePath get the file path standard error is written to when the output mode is separate
+func (c CommandType) stderrFilePath() string {
+	if c.StderrFilePath != "" {
+		return c.StderrFilePath
+	}
+	return c.FilePath + ".stderr"
+}
+
+// outputFilePaths get the file paths of all outputs of the command
+func (c CommandType) outputFilePaths() []string {
+	if c.Output == CommandOutputSeparate {
+		return []string{c.FilePath, c.stderrFilePath()}
+	}
+	return []string{c.FilePath}
+}
+
+// outputs get all output files of the command from the result
+func (r *commandResultT) outputs(command CommandType) []commandOutputT {
+	outputs := []commandOutputT{
+		{
+			FilePath: command.FilePath,
+			Data:     r.Output,
+		},
+	}
+	if command.Output == CommandOutputSeparate {
+		outputs = append(outputs, commandOutputT{
+			FilePath: command.stderrFilePath(),
+			Data:     r.Stderr,
+		})
+	}
+	return outputs
+}
+
+// defaultShell is the shell used to run shell commands if no shell interpreter is specified
+var defaultShell = []string{"/bin/sh", "-c"}
+
+// commandLine get the executable and arguments to run
+func (c CommandType) commandLine() (string, []string, error) {
+	if c.Shell == "" {
+		if c.ExePath == "" {
+			return "", nil, fmt.Errorf("either an executable path or a shell command is required")
+		}
+		return c.ExePath, c.Arguments, nil
+	}
+	if c.ExePath != "" || len(c.Arguments) > 0 {
+		return "", nil, fmt.Errorf("an executable path and arguments can not be used with a shell command")
+	}
+
+	shell := c.ShellInterpreter
+	if len(shell) == 0 {
+		shell = defaultShell
+	}
+	args := append(append([]string{}, shell[1:]...), c.Shell)
+	return shell[0], args, nil
+}
+
+// runCommand run the command and return its output. The command is run in its own process group, which is killed if
+// the context is cancelled or the command timeout expires. A result is always returned, even if there was an error.
+func runCommand(ctx context.Context, command CommandType) (*commandResultT, error) {
+	result := &commandResultT{ExitCode: -1}
+
+	switch command.Output {
+	case "", CommandOutputStdout, CommandOutputCombined, CommandOutputSeparate:
+	default:
+		return result, fmt.Errorf("invalid output mode '%s'", command.Output)
+	}
+	switch command.ExitPolicy {
+	case "", CommandExitPolicyFail, CommandExitPolicySnapshot:
+	default:
+		return result, fmt.Errorf("invalid exit policy '%s'", command.ExitPolicy)
+	}
+	normalizer, err := command.normalizer()
+	if err != nil {
+		return result, err
+	}
+	if command.Stdin != "" && command.StdinFile != "" {
+		return result, fmt.Errorf("only one of stdin or stdin_file may be specified")
+	}
+	exePath, args, err := command.commandLine()
+	if err != nil {
+		return result, err
+	}
+	credential, err := command.credential()
+	if err != nil {
+		return result, err
+	}
+	result.Credential = credential
+	env, err := command.environment()
+	if err != nil {
+		return result, err
+	}
+
+	log.Info("Running command '%s %s' -> '%s'", exePath, args, command.FilePath)
+	commandCtx := ctx
+	if command.Timeout > 0 {
+		var cancel context.CancelFunc
+		commandCtx, cancel = context.WithTimeout(ctx, command.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(commandCtx, exePath, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = commandWaitDelay
+	if command.WorkDir != "" {
+		cmd.Dir = command.WorkDir
+		log.Debug("Setting command workdir: %s", command.WorkDir)
+	}
+	if env != nil {
+		cmd.Env = env
+		// Only names are logged as values may have been read from secret files
+		names := []string{}
+		for _, variable := range command.Env {
+			name, _, _ := strings.Cut(variable, "=")
+			names = append(names, name)
+		}
+		log.Debug("Setting command environment variables: %s", names)
+	}
+	if credential != nil {
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid:    credential.UID,
+			Gid:    credential.GID,
+			Groups: credential.Groups,
+		}
+		log.Debug("Setting command UID, GID, and groups: %d, %d, %v", credential.UID, credential.GID, credential.Groups)
+		if command.SetUserEnv {
+			env := cmd.Env
+			if env == nil {
+				env = os.Environ()
+			}
+			cmd.Env = credential.environment(env)
+		}
+	}
+	if command.Stdin != "" {
+		cmd.Stdin = strings.NewReader(command.Stdin)
+	} else if command.StdinFile != "" {
+		stdin, err := os.Open(command.StdinFile)
+		if err != nil {
+			log.Error("Error opening standard input file '%s': %s", command.StdinFile, err.Error())
+			return result, err
+		}
+		defer stdin.Close()
+		cmd.Stdin = stdin
+	}
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	switch command.Output {
+	case CommandOutputCombined:
+		cmd.Stderr = &stdout
+	default:
+		cmd.Stderr = &stderr
+	}
+
+	start := time.Now()
+	err = cmd.Run()
+	result.Duration = time.Since(start)
+	result.Output = stdout.Bytes()
+	if command.Output == CommandOutputSeparate {
+		result.Stderr = stderr.Bytes()
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(commandCtx.Err(), context.DeadlineExceeded) {
+			log.Error("Command '%s %s' timed out after %s", exePath, args, command.Timeout)
+			return result, fmt.Errorf("%w after %s", ErrCommandTimeout, command.Timeout)
+		}
+		exitErr := &exec.ExitError{}
+		if !errors.As(err, &exitErr) || result.ExitCode < 0 {
+			log.Error("Error running command '%s %s': %s", exePath, args, err.Error())
+			return result, err
+		}
+		if command.ExitPolicy != CommandExitPolicySnapshot {
+			log.PError("Command exited with non-zero status", map[string]interface{}{
+				"command":   exePath,
+				"arguments": args,
+				"status":    result.ExitCode,
+				"stderr":    stderr.String(),
+			})
+			return result, fmt.Errorf("command exited with status %d", result.ExitCode)
+		}
+		log.Warn("Command '%s %s' exited with status %d", exePath, args, result.ExitCode)
+	}
+
+	if result.Output, err = normalizer.normalize(result.Output); err != nil {
+		log.Error("Error normalizing output of command '%s %s': %s", exePath, args, err.Error())
+		return result, err
+	}
+
+	return result, nil
+}
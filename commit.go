@@ -0,0 +1,168 @@
+package configsync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
+const (
+	// CommitStrategySingle commit all changes in a single commit. This is the default.
+	CommitStrategySingle = "single"
+	// CommitStrategyPerSource make one commit for each source group. See Options.SourceGroups.
+	CommitStrategyPerSource = "per-source"
+	// CommitStrategyPerFile make one commit for each changed file or command output
+	CommitStrategyPerFile = "per-file"
+)
+
+// commitGroupT describes the changes included in a single commit
+type commitGroupT struct {
+	Source   string
+	Added    []string
+	Modified []string
+	Removed  []string
+}
+
+func (g *commitGroupT) paths() []string {
+	paths := []string{}
+	for _, list := range [][]string{g.Added, g.Modified, g.Removed} {
+		for _, filePath := range list {
+			paths = append(paths, strings.TrimPrefix(filePath, "/"))
+		}
+	}
+	return paths
+}
+
+func validateCommitStrategy(strategy string) error {
+	switch strategy {
+	case "", CommitStrategySingle, CommitStrategyPerSource, CommitStrategyPerFile:
+		return nil
+	}
+	return fmt.Errorf("invalid commit strategy '%s'", strategy)
+}
+
+// groupChanges group the changes in the report by the commit strategy, in the order they were first seen. files are
+// all synced and removed files, used to find the source of each path.
+func groupChanges(options Options, report *Report, files []fileType) []*commitGroupT {
+	if options.Git.CommitStrategy != CommitStrategyPerSource && options.Git.CommitStrategy != CommitStrategyPerFile {
+		return nil
+	}
+
+	commandOutputs := map[string]string{}
+	for _, command := range options.Commands {
+		for _, filePath := range command.outputFilePaths() {
+			commandOutputs[filePath] = command.FilePath
+		}
+	}
+	sources := map[string]string{}
+	for _, file := range files {
+		source := file.Source
+		if source == fileSourceCommand {
+			source = file.Path
+			if commandFilePath, ok := commandOutputs[file.Path]; ok {
+				source = commandFilePath
+			}
+		}
+		if group, ok := options.SourceGroups[source]; ok {
+			source = group
+		}
+		sources[file.Path] = source
+	}
+
+	groups := []*commitGroupT{}
+	groupMap := map[string]*commitGroupT{}
+	groupFor := func(filePath string) *commitGroupT {
+		key := filePath
+		if options.Git.CommitStrategy == CommitStrategyPerSource {
+			if source, ok := sources[filePath]; ok {
+				key = source
+			}
+		}
+		group, ok := groupMap[key]
+		if !ok {
+			group = &commitGroupT{Source: key}
+			groupMap[key] = group
+			groups = append(groups, group)
+		}
+		return group
+	}
+	for _, filePath := range report.Added {
+		group := groupFor(filePath)
+		group.Added = append(group.Added, filePath)
+	}
+	for _, filePath := range report.Updated {
+		group := groupFor(filePath)
+		group.Modified = append(group.Modified, filePath)
+	}
+	for _, filePath := range report.Removed {
+		group := groupFor(filePath)
+		group.Removed = append(group.Removed, filePath)
+	}
+	return groups
+}
+
+// commitChanges commit all staged changes, with one commit for each group. The metadata is included in the last commit,
+// and any remaining changes are committed together. Returns the hashes of the commits that were made.
+func commitChanges(g git.Repository, author string, tmpl *template.Template, data CommitMessageDataType, groups []*commitGroupT) ([]string, error) {
+	commits := []string{}
+	commit := func(message string, paths []string) error {
+		var err error
+		if len(paths) == 0 {
+			err = g.Commit(message, author)
+		} else {
+			err = g.CommitPaths(message, author, paths...)
+		}
+		if errors.Is(err, git.ErrNothingToCommit) {
+			log.Debug("Nothing to commit for paths %v", paths)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error committing changes: %s", err.Error())
+		}
+		hash, err := g.HeadCommit()
+		if err != nil {
+			log.Error("Error getting commit hash: %s", err.Error())
+			return nil
+		}
+		commits = append(commits, *hash)
+		return nil
+	}
+
+	for i, group := range groups {
+		paths := group.paths()
+		if i == len(groups)-1 {
+			paths = append(paths, metadataFileName)
+		}
+		groupData := data
+		groupData.Source = group.Source
+		groupData.Added = group.Added
+		groupData.Modified = group.Modified
+		groupData.Removed = group.Removed
+		message, err := renderCommitMessage(tmpl, groupData)
+		if err != nil {
+			return commits, err
+		}
+		if err := commit(message, paths); err != nil {
+			return commits, err
+		}
+	}
+
+	changed, err := g.HasChanges()
+	if err != nil {
+		return commits, fmt.Errorf("error getting git status: %s", err.Error())
+	}
+	if len(groups) > 0 && !changed {
+		return commits, nil
+	}
+	message, err := renderCommitMessage(tmpl, data)
+	if err != nil {
+		return commits, err
+	}
+	if err := commit(message, nil); err != nil {
+		return commits, err
+	}
+	return commits, nil
+}
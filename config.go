@@ -1,14 +1,60 @@
 package configsync
 
+import (
+	"time"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
 // CommandType describes a command object
 type CommandType struct {
 	FilePath  string   `toml:"file_path"`
 	ExePath   string   `toml:"exe_path"`
 	Arguments []string `toml:"arguments"`
 	WorkDir   string   `toml:"work_dir"`
-	Env       []string `toml:"env"`
-	User      uint32   `toml:"uid"`
-	Group     uint32   `toml:"gid"`
+	// Environment variables in the format key=value. Values may reference host environment variables with
+	// '${env:NAME}' or the contents of files with '${file:/path}'.
+	Env []string `toml:"env"`
+	// How the environment of the command is built from Env. One of CommandEnvInherit (default), CommandEnvReplace, or
+	// CommandEnvClean.
+	EnvMode string `toml:"env_mode"`
+	// Optional user ID to run the command as. Also sets the ownership of the output file.
+	User *uint32 `toml:"uid"`
+	// Optional group ID to run the command as. Also sets the ownership of the output file.
+	Group *uint32 `toml:"gid"`
+	// Optional name of the user to run the command as, resolved when the command is run. Can not be used with User.
+	UserName string `toml:"user"`
+	// Optional name of the group to run the command as, resolved when the command is run. Can not be used with Group.
+	// If no group is specified but a user is, the user's primary group is used.
+	GroupName string `toml:"group"`
+	// Optional names or IDs of supplementary groups for the command. If omitted and a user is specified, the groups the
+	// user is a member of are used.
+	Groups []string `toml:"groups"`
+	// If true then the HOME, USER, and LOGNAME environment variables are set for the user the command runs as
+	SetUserEnv bool `toml:"set_user_env"`
+	// A command line run through ShellInterpreter, such as 'rpm -qa | sort'. Can not be used with ExePath or Arguments.
+	Shell string `toml:"shell"`
+	// The shell and its arguments used to run Shell. The command line is appended as the last argument. Defaults to
+	// '/bin/sh -c'.
+	ShellInterpreter []string `toml:"shell_interpreter"`
+	// Optional text written to the standard input of the command. Can not be used with StdinFile.
+	Stdin string `toml:"stdin"`
+	// Optional path of a file whose contents are written to the standard input of the command. The file is read by
+	// configsync, not the user the command runs as. Can not be used with Stdin.
+	StdinFile string `toml:"stdin_file"`
+	// Optional maximum duration the command may run for. If exceeded the command and all of its children are killed.
+	Timeout time.Duration `toml:"timeout"`
+	// Which output of the command to capture. One of CommandOutputStdout (default), CommandOutputCombined, or
+	// CommandOutputSeparate.
+	Output string `toml:"output"`
+	// The file path standard error is written to when Output is CommandOutputSeparate. Defaults to FilePath with a
+	// '.stderr' suffix.
+	StderrFilePath string `toml:"stderr_file_path"`
+	// How a non-zero exit status is treated. One of CommandExitPolicyFail (default) or CommandExitPolicySnapshot.
+	ExitPolicy string `toml:"exit_policy"`
+	// Steps to normalize the output of the command before it is hashed and written, run in order. Standard error
+	// written to StderrFilePath is not normalized.
+	Normalize []NormalizeStepType `toml:"normalize"`
 }
 
 // GitOptionsType describes the configuration type for git
@@ -16,6 +62,84 @@ type GitOptionsType struct {
 	Path          string `toml:"path"`
 	Author        string `toml:"author"`
 	RemoteEnabled bool   `toml:"remote_enabled"`
-	RemoteName    string `toml:"remote_name"`
-	BranchName    string `toml:"branch_name"`
+	// Optional name of the remote used for pulling and pushing. If omitted and the remote is enabled, 'origin' is used.
+	RemoteName string `toml:"remote_name"`
+	BranchName string `toml:"branch_name"`
+	// Which git implementation to use, one of GitBackendExec (the default) or GitBackendNative
+	Backend string `toml:"backend"`
+	// Optional branch that new host branches are started from, either a local branch or a branch on the remote. If
+	// omitted new host branches are orphans with no history.
+	BaseBranch string `toml:"base_branch"`
+	// Optional URL of the remote. If set and the remote is enabled, the remote is added or updated.
+	RemoteURL string `toml:"remote_url"`
+	// How changes on the remote branch are integrated before syncing, one of PullStrategyRebase (the default) or
+	// PullStrategyMerge
+	PullStrategy string `toml:"pull_strategy"`
+	// How many times a rejected push is retried after integrating the remote branch again. Defaults to 3, a negative
+	// value disables retries.
+	PushRetries int `toml:"push_retries"`
+	// Optional Go template for commit messages. See CommitMessageDataType for the available data. Defaults to
+	// DefaultCommitMessageTemplate.
+	MessageTemplate string `toml:"message_template"`
+	// Optional Go template for the name of an annotated tag made each time a sync makes a commit, such as
+	// 'sync-{{.Time.Format "20060102-150405"}}'. See CommitMessageDataType for the available data. The name must be
+	// unique for every sync.
+	TagTemplate string `toml:"tag_template"`
+	// How changes are split into commits. One of CommitStrategySingle (default), CommitStrategyPerSource, or
+	// CommitStrategyPerFile.
+	CommitStrategy string `toml:"commit_strategy"`
+	// Optional format used to sign commits and verify signatures. One of git.SigningFormatGPG or git.SigningFormatSSH.
+	SigningFormat string `toml:"signing_format"`
+	// The GPG key ID, or path to the SSH key, used to sign commits. If empty commits are not signed.
+	SigningKey string `toml:"signing_key"`
+	// Path to the SSH allowed signers file used to verify SSH signatures
+	AllowedSignersFile string `toml:"allowed_signers_file"`
+	// How commit signatures are verified before restoring. One of SignatureVerifyNone (default), SignatureVerifyWarn,
+	// or SignatureVerifyRequire.
+	VerifySignatures string `toml:"verify_signatures"`
+}
+
+// Options describes the options for a sync
+type Options struct {
+	// The git working directory where synced files are saved
+	WorkDir string
+	// Glob patterns or file paths of files to sync
+	FilePatterns []string
+	// Glob patterns of files or directories to never sync, even if they match a file pattern
+	ExcludePatterns []string
+	// Options for expanding directories and recursive '**' patterns
+	Walk WalkOptionsType
+	// Options for redacting secrets from files and command outputs before they are written to the work directory
+	Redaction RedactionOptionsType
+	// Options for encrypting sensitive files and command outputs before they are written to the work directory
+	Encryption EncryptionOptionsType
+	// Commands to run and sync the output of
+	Commands []CommandType
+	// Git options
+	Git GitOptionsType
+	// Optional repository to use instead of opening one in the work directory with the git backend, such as
+	// git.NewMemory
+	Repository git.Repository
+	// Optional names of the group each source belongs to, keyed by file pattern or command file path. Used by the
+	// per-source commit strategy, sources without a group are committed on their own.
+	SourceGroups map[string]string
+	// Optional reason for the sync, such as a ticket number, made available to the commit message template. The default
+	// template uses it as the subject of the commit.
+	Reason string
+	// Optional version of the application performing the sync, made available to the commit message template
+	Version string
+	// Optional name of an annotated tag made of the synced commit, even if there were no changes, such as
+	// 'pre-upgrade-2026-10-18'. It may be a Go template with the same data as the commit message template. Overrides
+	// the tag template in the git options.
+	Tag string
+}
+
+// WalkOptionsType describes the options for expanding directories and recursive '**' patterns
+type WalkOptionsType struct {
+	// The maximum number of directories deep to descend. 1 includes only files directly in the directory. 0 is unlimited.
+	MaxDepth int `toml:"max_depth"`
+	// If true then symbolic links to directories are followed
+	FollowSymlinks bool `toml:"follow_symlinks"`
+	// If true then files and directories beginning with '.' are skipped
+	SkipHidden bool `toml:"skip_hidden"`
 }
@@ -1,13 +1,12 @@
 package configsync
 
 import (
-	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path"
-	"path/filepath"
-	"syscall"
 	"time"
 
 	"github.com/ecnepsnai/configsync/git"
@@ -18,335 +17,489 @@ var log = logtic.Log.Connect("configsync")
 
 const fileSourceCommand = "cmd"
 
+// defaultRemoteName is the name of the remote if the remote is enabled without a name
+const defaultRemoteName = "origin"
+
 type fileToBackupT struct {
 	FilePath string
 	Source   string
 }
 
-// Start beging the sync process
-func Start(workDir string, filePatterns []string, commands []CommandType, gitOptions GitOptionsType) {
-	start := time.Now()
+type syncStatus int
+
+const (
+	syncStatusAdded syncStatus = iota
+	syncStatusUpdated
+	syncStatusUnchanged
+)
 
-	if gitOptions.Author == "" {
-		gitOptions.Author = "configsync <configsync@" + getHostname() + ">"
+// Start beging the sync process. Any fatal error is logged and will exit the process, use Run to handle errors.
+func Start(workDir string, filePatterns []string, commands []CommandType, gitOptions GitOptionsType) {
+	if _, err := Run(context.Background(), Options{
+		WorkDir:      workDir,
+		FilePatterns: filePatterns,
+		Commands:     commands,
+		Git:          gitOptions,
+	}); err != nil {
+		log.Fatal("%s", err.Error())
 	}
+}
+
+// Run perform the sync process and return a report of what was synced. Errors syncing individual files or commands
+// are included in the report, an error is only returned if the sync itself could not be completed. The report is
+// never nil, if an error is returned it describes what was done before the sync stopped, such as the commands that
+// ran and the commits that were made. If the remote could not be fetched (ErrFetch), integrated (ErrDiverged) or
+// pushed to, the changes are still committed and tagged locally before the error is returned.
+func Run(ctx context.Context, options Options) (*Report, error) {
+	start := time.Now()
+	report := &Report{}
+	defer func() {
+		report.Duration = time.Since(start)
+	}()
+
+	workDir := options.WorkDir
+	gitOptions := options.Git
+	gitOptions.Author = gitOptions.author()
 	if gitOptions.BranchName == "" {
-		gitOptions.BranchName = getHostname()
+		gitOptions.BranchName = defaultBranchName()
+	}
+	if gitOptions.RemoteName == "" && gitOptions.RemoteEnabled {
+		gitOptions.RemoteName = defaultRemoteName
 	}
 
 	log.Debug("Work directory: %s", workDir)
-	log.Debug("File patterns: %v", filePatterns)
-	log.Debug("Commands: %+v", commands)
+	log.Debug("File patterns: %v", options.FilePatterns)
+	log.Debug("Commands: %+v", options.Commands)
 	log.Debug("Git options: %+v", gitOptions)
 
+	redactor, err := options.Redaction.redactor()
+	if err != nil {
+		return report, err
+	}
+	encrypter, err := options.Encryption.encrypter()
+	if err != nil {
+		return report, err
+	}
+	messageTemplate, err := gitOptions.commitMessageTemplate()
+	if err != nil {
+		return report, err
+	}
+	if err := validateCommitStrategy(gitOptions.CommitStrategy); err != nil {
+		return report, err
+	}
+	if err := validatePullStrategy(gitOptions.PullStrategy); err != nil {
+		return report, err
+	}
+	tagTemplate, err := syncTagTemplate(options)
+	if err != nil {
+		return report, err
+	}
+
 	if err := makeDirectoryIfNotExists(workDir); err != nil {
-		log.PFatal("Error making work directory", map[string]interface{}{
+		log.PError("Error making work directory", map[string]interface{}{
 			"path":  workDir,
 			"error": err.Error(),
 		})
+		return report, fmt.Errorf("error making work directory: %s", err.Error())
 	}
 
-	git, err := git.New(gitOptions.Path, workDir)
+	repo, err := gitOptions.openGit(workDir, options.Repository)
 	if err != nil {
-		log.Fatal("error opening git instance: %s", err.Error())
+		return report, fmt.Errorf("error opening git instance: %w", err)
 	}
-	if err := git.InitIfNeeded(); err != nil {
-		log.Fatal("error initalizing git repo: %s", err.Error())
+	if err := repo.InitIfNeeded(); err != nil {
+		return report, fmt.Errorf("error initalizing git repo: %s", err.Error())
 	}
-	if git.HasChanges() {
+	if dirty, err := repo.HasChanges(); err != nil {
+		return report, fmt.Errorf("error getting git status: %s", err.Error())
+	} else if dirty {
 		log.Warn("working directory is dirty (has unstaged or untracked files)!")
 	}
-	if err := git.Checkout(gitOptions.BranchName); err != nil {
-		log.Fatal("error checking out git branch: %s", err.Error())
+	if gitOptions.RemoteEnabled {
+		if gitOptions.RemoteURL != "" {
+			if err := repo.SetRemote(gitOptions.RemoteName, gitOptions.RemoteURL); err != nil {
+				return report, fmt.Errorf("error configuring git remote: %s", err.Error())
+			}
+		}
+		if err := repo.Fetch(gitOptions.RemoteName); errors.Is(err, git.ErrUnsupported) {
+			return report, fmt.Errorf("error fetching from remote: %w", err)
+		} else if errors.Is(err, git.ErrAuthentication) {
+			log.Error("Authentication failed fetching from remote '%s', check the credentials for the remote", gitOptions.RemoteName)
+			report.FetchError = err
+		} else if err != nil {
+			log.Warn("Error fetching from remote: %s", err.Error())
+			report.FetchError = err
+		}
+	}
+	checkoutOptions := git.CheckoutOptions{
+		Base: gitOptions.BaseBranch,
 	}
 	if gitOptions.RemoteEnabled {
-		git.Pull()
+		checkoutOptions.Remote = gitOptions.RemoteName
+	}
+	if err := repo.Checkout(gitOptions.BranchName, checkoutOptions); err != nil {
+		return report, fmt.Errorf("error checking out git branch: %s", err.Error())
+	}
+	// Integrate changes from the remote before syncing so that the sync commits on top of them. If they can't be
+	// integrated the sync is still committed locally, only pushing is skipped.
+	if gitOptions.RemoteEnabled && report.FetchError == nil {
+		report.PushError = integrateRemote(repo, gitOptions, report)
 	}
 
-	metadataPath := path.Join(workDir, "configsync_meta.json")
+	metadataPath := path.Join(workDir, metadataFileName)
 	metadata := tryLoadMeta(metadataPath)
 
-	commandFileMap := map[string]bool{}
-	for _, command := range commands {
-		commandFileMap[command.FilePath] = true
-	}
-	fileMap := map[string]bool{}
-	for _, pattern := range filePatterns {
-		fileMap[pattern] = true
+	plan, err := buildPlan(ctx, options, metadata, redactor, encrypter)
+	if err != nil {
+		return report, err
 	}
+	report.Failed = append(report.Failed, plan.Failed...)
 
-	filesToRemove := []string{}
+	previousFiles := map[string]fileType{}
 	for _, file := range metadata.Files {
-		syncPath := path.Join(workDir, file.Path)
-		shouldRemove := false
-		if file.Source == fileSourceCommand {
-			if !commandFileMap[file.Path] {
-				log.Warn("Will remove command output '%s' ('%s') because it was removed from the config", file.Path, syncPath)
-				shouldRemove = true
-			}
-		} else {
-			if !fileMap[file.Source] {
-				log.Warn("Will remove file '%s' ('%s') because it was removed from the config", file.Path, syncPath)
-				shouldRemove = true
-			}
-			if !fileExists(file.Path) {
-				log.Warn("Will remove file '%s' ('%s') because the source no longer exists", file.Path, syncPath)
-				shouldRemove = true
-			}
-		}
-		if shouldRemove {
-			filesToRemove = append(filesToRemove, syncPath)
-		}
+		previousFiles[file.Path] = file
 	}
-	if len(filesToRemove) > 0 {
-		git.Remove(filesToRemove...)
-	}
-
 	metadata.Files = []fileType{}
 
-	filesToBackup := []fileToBackupT{}
-	for _, pattern := range filePatterns {
-		if fileExists(pattern) {
-			filesToBackup = append(filesToBackup, fileToBackupT{
-				FilePath: pattern,
-				Source:   pattern,
-			})
-			continue
+	for _, plannedFile := range plan.files {
+		if err := ctx.Err(); err != nil {
+			return report, err
 		}
 
-		paths, err := filepath.Glob(pattern)
-		if err != nil {
-			log.Error("Invalid glob pattern '%s'", pattern)
+		if plannedFile.Action == fileActionUnchanged {
+			log.Info("No changes to already synced file '%s'", plannedFile.File.Path)
+			metadata.Files = append(metadata.Files, plannedFile.File)
+			report.Unchanged = append(report.Unchanged, plannedFile.File.Path)
 			continue
 		}
-		if len(paths) == 0 {
-			log.Warn("No files matched glob '%s'", pattern)
+
+		if err := syncFile(workDir, plannedFile.File, redactor, encrypter); err != nil {
+			report.fail(plannedFile.File.Path, err)
 			continue
 		}
-		log.Info("Expanding glob '%s' to -> %v", pattern, paths)
-		for _, globPath := range paths {
-			info, err := os.Stat(globPath)
-			if err != nil {
-				log.PError("Error querying path from glob", map[string]interface{}{
-					"path":  globPath,
-					"error": err.Error(),
-					"glob":  pattern,
-				})
-				continue
-			}
-			if info.IsDir() {
-				files, err := listAllFilesInDirectory(globPath)
-				if err != nil {
-					log.PError("Error listing files in directory", map[string]interface{}{
-						"path":  globPath,
-						"error": err.Error(),
-					})
-					continue
-				}
-				log.Info("Expanding directory '%s' to -> %v", globPath, files)
-				for _, file := range files {
-					filesToBackup = append(filesToBackup, fileToBackupT{
-						FilePath: file,
-						Source:   pattern,
-					})
-				}
-			} else {
-				filesToBackup = append(filesToBackup, fileToBackupT{
-					FilePath: globPath,
-					Source:   pattern,
-				})
-			}
+		metadata.Files = append(metadata.Files, plannedFile.File)
+		if plannedFile.Action == fileActionAdd {
+			report.Added = append(report.Added, plannedFile.File.Path)
+		} else {
+			report.Updated = append(report.Updated, plannedFile.File.Path)
 		}
 	}
 
-	for _, fileToBackup := range filesToBackup {
-		log.Info("Syncing file '%s'", fileToBackup.FilePath)
-		var destHash uint64 = 0
-		syncAtomicPath := path.Join(workDir, fileToBackup.FilePath+"_")
-		syncPath := path.Join(workDir, fileToBackup.FilePath)
-		if fileExists(syncPath) {
-			destHash, err = hashFile(syncPath)
-			if err != nil {
-				continue
-			}
-		}
-		sourceHash, err := hashFile(fileToBackup.FilePath)
-		if err != nil {
-			continue
+	for _, command := range options.Commands {
+		if err := ctx.Err(); err != nil {
+			return report, err
 		}
 
-		info, err := os.Stat(fileToBackup.FilePath)
+		files, result, err := syncCommand(ctx, workDir, command, previousFiles, redactor, encrypter)
+		report.Commands = append(report.Commands, CommandResultType{
+			FilePath:  command.FilePath,
+			ExePath:   command.ExePath,
+			Arguments: command.Arguments,
+			Shell:     command.Shell,
+			Error:     err,
+			TimedOut:  errors.Is(err, ErrCommandTimeout),
+			ExitCode:  result.ExitCode,
+			Duration:  result.Duration,
+		})
 		if err != nil {
-			log.Error("Error stat-ing file: %s", err.Error())
+			report.fail(command.FilePath, err)
+			// Keep the previous output so that it isn't orphaned, but record that it's stale
+			for _, filePath := range command.outputFilePaths() {
+				previous, ok := previousFiles[filePath]
+				if !ok || previous.Source != fileSourceCommand {
+					continue
+				}
+				info := &commandInfoType{ExitCode: result.ExitCode, Stale: true}
+				if previous.Command != nil {
+					info.Duration = previous.Command.Duration
+				}
+				previous.Command = info
+				metadata.Files = append(metadata.Files, previous)
+			}
 			continue
 		}
-
-		var UID int
-		var GID int
-		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
-			UID = int(stat.Uid)
-			GID = int(stat.Gid)
+		for _, file := range files {
+			metadata.Files = append(metadata.Files, file.File)
+			report.addStatus(file.File.Path, file.Status)
 		}
+	}
 
-		if sourceHash == destHash {
-			log.Info("No changes to already synced file '%s'", syncPath)
-			metadata.Files = append(metadata.Files, fileType{
-				Path: fileToBackup.FilePath,
-				Hash: destHash,
-				Info: fileInfoType{
-					Mode: uint32(info.Mode()),
-					UID:  UID,
-					GID:  GID,
-				},
-				Source: fileToBackup.Source,
-			})
-			continue
-		}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
 
-		syncDir := pathWithoutFile(syncPath)
-		if err := makeDirectoryIfNotExists(syncDir); err != nil {
-			log.PError("Error making sync directory", map[string]interface{}{
-				"path":  syncDir,
-				"error": err.Error(),
-			})
-			continue
+	// Files are only removed once the sync can no longer be cancelled so that the metadata always lists
+	// what's in the index
+	if len(plan.remove) > 0 {
+		filesToRemove := make([]string, len(plan.remove))
+		for i, file := range plan.remove {
+			filesToRemove[i] = path.Join(workDir, file.Path)
 		}
+		if err := repo.Remove(filesToRemove...); err != nil {
+			return report, fmt.Errorf("error removing files: %s", err.Error())
+		}
+		report.Removed = plan.Remove
+	}
 
-		source, err := os.OpenFile(fileToBackup.FilePath, os.O_RDONLY, 0644)
-		if err != nil {
-			log.Error("Error opening source file: %s", err.Error())
-			continue
+	if err := saveMetadata(metadataPath, metadata); err != nil {
+		return report, err
+	}
+
+	data := CommitMessageDataType{
+		Hostname: getHostname(),
+		Branch:   gitOptions.BranchName,
+		Time:     start,
+		Version:  options.Version,
+		Reason:   options.Reason,
+		Added:    report.Added,
+		Modified: report.Updated,
+		Removed:  report.Removed,
+	}
+	changed, err := repo.HasChanges()
+	if err != nil {
+		return report, fmt.Errorf("error getting git status: %s", err.Error())
+	}
+	if changed {
+		if err := repo.Add(workDir); err != nil {
+			return report, fmt.Errorf("error adding files: %s", err.Error())
 		}
-		dest, err := os.OpenFile(syncAtomicPath, os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			log.Error("Error opening destination file: %s", err.Error())
-			continue
+		groups := groupChanges(options, report, append(metadata.Files, plan.remove...))
+		commits, err := commitChanges(repo, gitOptions.Author, messageTemplate, data, groups)
+		report.Commits = commits
+		if len(commits) > 0 {
+			report.Committed = true
+			report.CommitHash = commits[len(commits)-1]
 		}
-
-		wrote, err := io.CopyBuffer(dest, source, nil)
-		dest.Close()
 		if err != nil {
-			log.Error("Error copying source file: %s", err.Error())
-			continue
+			return report, err
 		}
-		if wrote != info.Size() {
-			log.Error("Did not copy entire source file")
-			continue
+	}
+	if gitOptions.RemoteEnabled && report.FetchError == nil && report.PushError == nil && hasUnpushedCommits(repo, gitOptions) {
+		if err := pushRemote(repo, gitOptions, report); err != nil {
+			log.Error("Error pushing to remote: %s", err.Error())
+			report.PushError = err
+		} else {
+			report.Pushed = true
 		}
-
-		if err := os.Rename(syncAtomicPath, syncPath); err != nil {
-			log.Error("Error writing replacement file '%s': %s", syncPath, err.Error())
-			continue
+	}
+	// Tag after pushing, as integrating the remote branch may have rewritten the commits
+	if tagTemplate != nil && (options.Tag != "" || report.Committed) {
+		if err := tagSync(repo, gitOptions, tagTemplate, data, report); err != nil {
+			return report, err
 		}
+	}
 
-		destHash, err = hashFile(syncPath)
-		if err != nil {
-			continue
-		}
-		if sourceHash != destHash {
-			log.Error("Source and destination hash do not match. %d != %d", sourceHash, destHash)
-			continue
-		}
+	report.Duration = time.Since(start)
+	if report.FetchError != nil {
+		// The changes were committed locally, but the sync is incomplete until they can be pushed
+		return report, fmt.Errorf("%w: %w", ErrFetch, report.FetchError)
+	}
+	if report.PushError != nil {
+		return report, report.PushError
+	}
+	log.Info("Finished in %s", report.Duration)
+	return report, nil
+}
 
-		metadata.Files = append(metadata.Files, fileType{
-			Path: fileToBackup.FilePath,
-			Hash: destHash,
-			Info: fileInfoType{
-				Mode: uint32(info.Mode()),
-				UID:  UID,
-				GID:  GID,
-			},
-			Source: fileToBackup.Source,
+// syncFile copy the file to the work directory and verify that it matches the expected hash. Files with redacted
+// secrets or that should be encrypted are transformed before they are written.
+func syncFile(workDir string, file fileType, redactor *redactorT, encrypter *encrypterT) error {
+	log.Info("Syncing file '%s'", file.Path)
+	syncAtomicPath := path.Join(workDir, file.Path+"_")
+	syncPath := path.Join(workDir, file.Path)
+
+	syncDir := pathWithoutFile(syncPath)
+	if err := makeDirectoryIfNotExists(syncDir); err != nil {
+		log.PError("Error making sync directory", map[string]interface{}{
+			"path":  syncDir,
+			"error": err.Error(),
 		})
-		log.Info("Successfully synced file '%s'", fileToBackup.FilePath)
-	}
-
-	for _, command := range commands {
-		log.Info("Running command '%s %s' -> '%s'", command.ExePath, command.Arguments, command.FilePath)
-		syncAtomicPath := path.Join(workDir, command.FilePath+"_")
-		syncPath := path.Join(workDir, command.FilePath)
-		syncDir := pathWithoutFile(syncPath)
-		if err := makeDirectoryIfNotExists(syncDir); err != nil {
-			log.PError("Error making sync directory", map[string]interface{}{
-				"path":  syncDir,
-				"error": err.Error(),
-			})
-			continue
-		}
+		return err
+	}
 
-		cmd := exec.Command(command.ExePath, command.Arguments...)
-		if command.WorkDir != "" {
-			cmd.Dir = command.WorkDir
-			log.Debug("Setting command workdir: %s", command.WorkDir)
+	if file.Redacted || file.Encrypted {
+		data, err := readSourceFile(file.Path, redactor)
+		if err != nil {
+			return err
 		}
-		if len(command.Env) > 0 {
-			cmd.Env = command.Env
-			log.Debug("Setting command environment variables: %s", command.Env)
+		if hash := hashBytes(data); hash != file.Hash {
+			log.Error("Source and destination hash do not match. %d != %d", file.Hash, hash)
+			return fmt.Errorf("source and destination hash do not match")
 		}
-		if command.User > 0 && command.Group > 0 {
-			cmd.SysProcAttr.Credential = &syscall.Credential{
-				Uid: command.User,
-				Gid: command.Group,
+		if file.Encrypted {
+			data, err = encrypter.encrypt(file.Path, data)
+			if err != nil {
+				log.Error("Error encrypting file '%s': %s", file.Path, err.Error())
+				return err
 			}
-			log.Debug("Setting command UID and GID: %d, %d", command.User, command.Group)
 		}
-		var buf bytes.Buffer
-		cmd.Stdout = &buf
-		if err := cmd.Run(); err != nil {
-			log.Error("Error running command '%s %s': %s", command.ExePath, command.Arguments, err.Error())
-			continue
+		if err := writeFileAtomic(syncPath, data); err != nil {
+			return err
 		}
+		log.Info("Successfully synced file '%s'", file.Path)
+		return nil
+	}
 
-		dest, err := os.OpenFile(syncAtomicPath, os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			log.Error("Error opening destination file: %s", err.Error())
-			continue
-		}
+	source, err := os.OpenFile(file.Path, os.O_RDONLY, 0644)
+	if err != nil {
+		log.Error("Error opening source file: %s", err.Error())
+		return err
+	}
+	defer source.Close()
+	dest, err := os.OpenFile(syncAtomicPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Error("Error opening destination file: %s", err.Error())
+		return err
+	}
 
-		_, err = io.CopyBuffer(dest, &buf, nil)
-		dest.Close()
+	_, err = io.CopyBuffer(dest, source, nil)
+	dest.Close()
+	if err != nil {
+		log.Error("Error copying source file: %s", err.Error())
+		os.Remove(syncAtomicPath)
+		return err
+	}
+
+	destHash, err := hashFile(syncAtomicPath)
+	if err != nil {
+		os.Remove(syncAtomicPath)
+		return err
+	}
+	if file.Hash != destHash {
+		log.Error("Source and destination hash do not match. %d != %d", file.Hash, destHash)
+		os.Remove(syncAtomicPath)
+		return fmt.Errorf("source and destination hash do not match")
+	}
+
+	if err := os.Rename(syncAtomicPath, syncPath); err != nil {
+		log.Error("Error writing replacement file '%s': %s", syncPath, err.Error())
+		return err
+	}
+
+	log.Info("Successfully synced file '%s'", file.Path)
+	return nil
+}
+
+type syncedCommandFileT struct {
+	File   fileType
+	Status syncStatus
+}
+
+// syncCommand run the command and write its outputs to the work directory. A result is always returned, even if
+// there was an error.
+func syncCommand(ctx context.Context, workDir string, command CommandType, previousFiles map[string]fileType, redactor *redactorT, encrypter *encrypterT) ([]syncedCommandFileT, *commandResultT, error) {
+	result, err := runCommand(ctx, command)
+	if err != nil {
+		return nil, result, err
+	}
+
+	info := &commandInfoType{
+		ExitCode: result.ExitCode,
+		Duration: result.Duration,
+	}
+	files := []syncedCommandFileT{}
+	for _, output := range result.outputs(command) {
+		var previous *fileType
+		if file, ok := previousFiles[output.FilePath]; ok && file.Source == fileSourceCommand {
+			previous = &file
+		}
+		file, status, err := syncCommandOutput(workDir, command, output, info, result.Credential, previous, redactor, encrypter)
 		if err != nil {
-			os.Remove(syncAtomicPath)
-			continue
+			return nil, result, err
 		}
+		files = append(files, syncedCommandFileT{
+			File:   *file,
+			Status: status,
+		})
+	}
+	return files, result, nil
+}
 
-		if err := os.Rename(syncAtomicPath, syncPath); err != nil {
-			log.Error("Error writing replacement file '%s': %s", syncPath, err.Error())
-			continue
+// syncCommandOutput write the output of a command to the work directory. The output is only written if its hash
+// differs from the previously synced output.
+func syncCommandOutput(workDir string, command CommandType, output commandOutputT, info *commandInfoType, credential *commandCredentialT, previous *fileType, redactor *redactorT, encrypter *encrypterT) (*fileType, syncStatus, error) {
+	status := syncStatusAdded
+	syncPath := path.Join(workDir, output.FilePath)
+	syncDir := pathWithoutFile(syncPath)
+	if err := makeDirectoryIfNotExists(syncDir); err != nil {
+		log.PError("Error making sync directory", map[string]interface{}{
+			"path":  syncDir,
+			"error": err.Error(),
+		})
+		return nil, status, err
+	}
+	if fileExists(syncPath) {
+		status = syncStatusUpdated
+	}
+
+	redactPatterns := redactor.forCommand(command.FilePath)
+	data := redactor.redact(output.Data, redactPatterns)
+
+	file := &fileType{
+		Path:   output.FilePath,
+		Hash:   hashBytes(data),
+		Source: fileSourceCommand,
+		Info: fileInfoType{
+			Mode: uint32(os.ModePerm),
+		},
+		Redacted:  len(redactPatterns) > 0,
+		Encrypted: encrypter.shouldEncrypt(command.FilePath) || encrypter.shouldEncrypt(output.FilePath),
+		Command:   info,
+	}
+	if credential != nil {
+		file.Info.UID = int(credential.UID)
+		file.Info.GID = int(credential.GID)
+	} else {
+		file.Info.UID = os.Getuid()
+		file.Info.GID = os.Getgid()
+	}
+
+	if status == syncStatusUpdated && previous != nil && previous.Hash == file.Hash && previous.Encrypted == file.Encrypted {
+		// Keep the previous duration so that the metadata only changes when the output or exit status does
+		if previous.Command != nil && previous.Command.ExitCode == info.ExitCode && !previous.Command.Stale {
+			file.Command = previous.Command
 		}
+		log.Info("No changes to already synced file '%s'", syncPath)
+		return file, syncStatusUnchanged, nil
+	}
 
-		destHash, err := hashFile(syncPath)
+	if file.Encrypted {
+		encrypted, err := encrypter.encrypt(output.FilePath, data)
 		if err != nil {
-			continue
+			log.Error("Error encrypting file '%s': %s", output.FilePath, err.Error())
+			return nil, status, err
 		}
+		data = encrypted
+	}
+	if err := writeFileAtomic(syncPath, data); err != nil {
+		return nil, status, err
+	}
 
-		file := fileType{
-			Path:   command.FilePath,
-			Hash:   destHash,
-			Source: fileSourceCommand,
-			Info: fileInfoType{
-				Mode: uint32(os.ModePerm),
-			},
-		}
-		if command.User > 0 && command.Group > 0 {
-			file.Info.UID = int(command.User)
-			file.Info.GID = int(command.Group)
-		}
+	log.Info("Successfully synced file '%s'", output.FilePath)
+	return file, status, nil
+}
 
-		metadata.Files = append(metadata.Files, file)
-		log.Info("Successfully synced file '%s'", command.FilePath)
+// writeFileAtomic write data to a temporary file and then rename it to filePath
+func writeFileAtomic(filePath string, data []byte) error {
+	atomicPath := filePath + "_"
+	dest, err := os.OpenFile(atomicPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Error("Error opening destination file: %s", err.Error())
+		return err
 	}
 
-	saveMetadata(metadataPath, metadata)
-
-	if git.HasChanges() {
-		git.Add(workDir)
-		git.Commit("Automatic config sync", gitOptions.Author)
-		if gitOptions.RemoteEnabled {
-			git.Push(gitOptions.RemoteName, gitOptions.BranchName)
-		}
+	_, err = dest.Write(data)
+	dest.Close()
+	if err != nil {
+		log.Error("Error writing destination file: %s", err.Error())
+		os.Remove(atomicPath)
+		return err
 	}
 
-	finished := time.Since(start)
-	log.Info("Finished in %s", finished)
+	if err := os.Rename(atomicPath, filePath); err != nil {
+		log.Error("Error writing replacement file '%s': %s", filePath, err.Error())
+		os.Remove(atomicPath)
+		return err
+	}
+	return nil
 }
@@ -1,15 +1,20 @@
 package configsync_test
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ecnepsnai/configsync"
+	"github.com/ecnepsnai/configsync/git"
 	"github.com/ecnepsnai/logtic"
 )
 
@@ -70,6 +75,19 @@ func touchFile(filePath string) error {
 	return nil
 }
 
+// runGit run git in dir and get its output, failing the test if it doesn't succeed
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Error running git %v: %s %s", args, err.Error(), out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
 func TestConfigsyncGlob(t *testing.T) {
 	t.Parallel()
 
@@ -253,9 +271,7 @@ func TestConfigsyncExistingGitWorkdir(t *testing.T) {
 
 	workDir := t.TempDir()
 
-	c := exec.Command("git", "init")
-	c.Dir = workDir
-	c.CombinedOutput()
+	runGit(t, workDir, "init")
 
 	files := []string{}
 	commands := []configsync.CommandType{
@@ -267,3 +283,1579 @@ func TestConfigsyncExistingGitWorkdir(t *testing.T) {
 	}
 	configsync.Start(workDir, files, commands, gitOptions)
 }
+
+func TestConfigsyncRunReport(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+
+	touchFile(path.Join(tmp, "1.txt"))
+	touchFile(path.Join(tmp, "2.txt"))
+
+	options := configsync.Options{
+		WorkDir: workDir,
+		FilePatterns: []string{
+			path.Join(tmp, "1.txt"),
+			path.Join(tmp, "2.txt"),
+		},
+		Commands: []configsync.CommandType{
+			{
+				ExePath:   "/bin/bash",
+				Arguments: []string{"-c", "echo hello"},
+				FilePath:  "/hello",
+			},
+			{
+				ExePath:   "/bin/bash",
+				Arguments: []string{"-c", "exit 1"},
+				FilePath:  "/fail",
+			},
+		},
+		Git: gitOptions,
+	}
+
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Added) != 3 {
+		t.Errorf("Unexpected number of added files. Expected 3 got %d", len(report.Added))
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Path != "/fail" {
+		t.Errorf("Unexpected failed files: %+v", report.Failed)
+	}
+	if len(report.Commands) != 2 {
+		t.Errorf("Unexpected number of commands. Expected 2 got %d", len(report.Commands))
+	}
+	if !report.Committed || report.CommitHash == "" {
+		t.Errorf("Expected a commit to be made")
+	}
+
+	touchFile(path.Join(tmp, "1.txt"))
+	options.FilePatterns = options.FilePatterns[:1]
+	options.Commands = options.Commands[:1]
+
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Updated) != 1 || report.Updated[0] != path.Join(tmp, "1.txt") {
+		t.Errorf("Unexpected updated files: %v", report.Updated)
+	}
+	if len(report.Unchanged) != 1 || report.Unchanged[0] != "/hello" {
+		t.Errorf("Unexpected unchanged files: %v", report.Unchanged)
+	}
+	if len(report.Removed) != 1 || report.Removed[0] != path.Join(tmp, "2.txt") {
+		t.Errorf("Unexpected removed files: %v", report.Removed)
+	}
+}
+
+func TestConfigsyncPlan(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+
+	touchFile(path.Join(tmp, "1.txt"))
+	touchFile(path.Join(tmp, "2.txt"))
+
+	options := configsync.Options{
+		WorkDir: path.Join(workDir, "repo"),
+		FilePatterns: []string{
+			path.Join(tmp, "*.txt"),
+		},
+		Git: gitOptions,
+	}
+
+	plan, err := configsync.Plan(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error planning sync: %s", err.Error())
+	}
+	if len(plan.Add) != 2 {
+		t.Errorf("Unexpected number of files to add. Expected 2 got %d", len(plan.Add))
+	}
+	if _, err := os.Stat(options.WorkDir); !os.IsNotExist(err) {
+		t.Errorf("Plan should not create the work directory")
+	}
+
+	if _, err := configsync.Run(context.Background(), options); err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	touchFile(path.Join(tmp, "1.txt"))
+	touchFile(path.Join(tmp, "3.txt"))
+	os.Remove(path.Join(tmp, "2.txt"))
+	syncedBefore, _ := os.ReadFile(path.Join(options.WorkDir, tmp, "1.txt"))
+
+	plan, err = configsync.Plan(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error planning sync: %s", err.Error())
+	}
+	if len(plan.Add) != 1 || plan.Add[0] != path.Join(tmp, "3.txt") {
+		t.Errorf("Unexpected files to add: %v", plan.Add)
+	}
+	if len(plan.Modify) != 1 || plan.Modify[0] != path.Join(tmp, "1.txt") {
+		t.Errorf("Unexpected files to modify: %v", plan.Modify)
+	}
+	if len(plan.Remove) != 1 || plan.Remove[0] != path.Join(tmp, "2.txt") {
+		t.Errorf("Unexpected files to remove: %v", plan.Remove)
+	}
+
+	syncedAfter, _ := os.ReadFile(path.Join(options.WorkDir, tmp, "1.txt"))
+	if string(syncedBefore) != string(syncedAfter) {
+		t.Errorf("Plan should not modify synced files")
+	}
+	if _, err := os.Stat(path.Join(options.WorkDir, tmp, "3.txt")); !os.IsNotExist(err) {
+		t.Errorf("Plan should not add files")
+	}
+}
+
+func TestConfigsyncRemoveUntracked(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range []string{configsync.GitBackendExec, configsync.GitBackendNative} {
+		workDir := t.TempDir()
+		tmp := t.TempDir()
+		touchFile(path.Join(tmp, "1.txt"))
+		touchFile(path.Join(tmp, "2.txt"))
+		touchFile(path.Join(tmp, "3.txt"))
+
+		backendGitOptions := gitOptions
+		backendGitOptions.Backend = backend
+		options := configsync.Options{
+			WorkDir:      workDir,
+			FilePatterns: []string{path.Join(tmp, "*.txt")},
+			Git:          backendGitOptions,
+		}
+		if _, err := configsync.Run(context.Background(), options); err != nil {
+			t.Fatalf("Unexpected error running sync with %s: %s", backend, err.Error())
+		}
+
+		// Files that are listed in the metadata but no longer in the index, as left by an interrupted sync
+		runGit(t, workDir, "rm", "-f", "-q", path.Join(workDir, tmp, "2.txt"))
+		runGit(t, workDir, "rm", "--cached", "-q", path.Join(workDir, tmp, "3.txt"))
+		os.Remove(path.Join(tmp, "2.txt"))
+		os.Remove(path.Join(tmp, "3.txt"))
+
+		report, err := configsync.Run(context.Background(), options)
+		if err != nil {
+			t.Fatalf("Unexpected error running sync with %s: %s", backend, err.Error())
+		}
+		if len(report.Removed) != 2 || !report.Committed {
+			t.Errorf("Unexpected report with %s: %+v", backend, report)
+		}
+		if _, err := os.Stat(path.Join(workDir, tmp, "3.txt")); !os.IsNotExist(err) {
+			t.Errorf("Expected untracked file to be removed from the work directory with %s", backend)
+		}
+		if files := runGit(t, workDir, "ls-files"); strings.Contains(files, "3.txt") {
+			t.Errorf("Expected untracked file to not be added again with %s: %s", backend, files)
+		}
+	}
+}
+
+func TestConfigsyncRestore(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+	altRoot := t.TempDir()
+
+	filePath := path.Join(tmp, "restore.txt")
+	os.WriteFile(filePath, []byte("one"), 0640)
+
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{filePath},
+		Git:          gitOptions,
+	}
+	first, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	os.WriteFile(filePath, []byte("two"), 0640)
+	if _, err := configsync.Run(context.Background(), options); err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	report, err := configsync.Restore(context.Background(), configsync.RestoreOptions{
+		WorkDir:  workDir,
+		Git:      gitOptions,
+		Revision: first.CommitHash,
+		Root:     altRoot,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error restoring: %s", err.Error())
+	}
+	if len(report.Restored) != 1 {
+		t.Errorf("Unexpected number of restored files. Expected 1 got %d", len(report.Restored))
+	}
+	data, _ := os.ReadFile(path.Join(altRoot, filePath))
+	if string(data) != "one" {
+		t.Errorf("Unexpected restored file content. Expected 'one' got '%s'", data)
+	}
+	info, err := os.Stat(path.Join(altRoot, filePath))
+	if err != nil {
+		t.Fatalf("Restored file not found: %s", err.Error())
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Unexpected restored file mode. Expected %s got %s", os.FileMode(0640), info.Mode().Perm())
+	}
+
+	os.WriteFile(filePath, []byte("three"), 0640)
+	report, err = configsync.Restore(context.Background(), configsync.RestoreOptions{
+		WorkDir: workDir,
+		Git:     gitOptions,
+		Paths:   []string{tmp},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error restoring: %s", err.Error())
+	}
+	data, _ = os.ReadFile(filePath)
+	if string(data) != "two" {
+		t.Errorf("Unexpected restored file content. Expected 'two' got '%s'", data)
+	}
+	if len(report.Backups) != 1 {
+		t.Fatalf("Unexpected number of backups. Expected 1 got %d", len(report.Backups))
+	}
+	data, _ = os.ReadFile(report.Backups[0])
+	if string(data) != "three" {
+		t.Errorf("Unexpected backup file content. Expected 'three' got '%s'", data)
+	}
+}
+
+func TestConfigsyncDrift(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+
+	os.WriteFile(path.Join(tmp, "1.txt"), []byte("one\n"), 0644)
+	os.WriteFile(path.Join(tmp, "2.txt"), []byte("two\n"), 0644)
+
+	options := configsync.DriftOptions{
+		Options: configsync.Options{
+			WorkDir: workDir,
+			FilePatterns: []string{
+				path.Join(tmp, "*.txt"),
+			},
+			Commands: []configsync.CommandType{
+				{
+					ExePath:   "/bin/bash",
+					Arguments: []string{"-c", "echo hello"},
+					FilePath:  "/hello",
+				},
+			},
+			Git: gitOptions,
+		},
+	}
+	if _, err := configsync.Run(context.Background(), options.Options); err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	report, err := configsync.Drift(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error checking drift: %s", err.Error())
+	}
+	if report.HasDrift() {
+		t.Errorf("Unexpected drift: %s", report.Diff)
+	}
+
+	os.WriteFile(path.Join(tmp, "1.txt"), []byte("uno\n"), 0644)
+	os.WriteFile(path.Join(tmp, "3.txt"), []byte("three\n"), 0644)
+	os.Remove(path.Join(tmp, "2.txt"))
+	options.Commands[0].Arguments = []string{"-c", "echo goodbye"}
+
+	report, err = configsync.Drift(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error checking drift: %s", err.Error())
+	}
+	if len(report.Added) != 1 || report.Added[0] != path.Join(tmp, "3.txt") {
+		t.Errorf("Unexpected added files: %v", report.Added)
+	}
+	if len(report.Modified) != 2 {
+		t.Errorf("Unexpected modified files: %v", report.Modified)
+	}
+	if len(report.Removed) != 1 || report.Removed[0] != path.Join(tmp, "2.txt") {
+		t.Errorf("Unexpected removed files: %v", report.Removed)
+	}
+	if !strings.Contains(report.Diff, "-one\n+uno\n") {
+		t.Errorf("Diff does not contain expected change:\n%s", report.Diff)
+	}
+
+	if status := runGit(t, workDir, "status", "--porcelain"); status != "" {
+		t.Errorf("Drift should not modify the work directory: %s", status)
+	}
+}
+
+func TestConfigsyncCommandTimeout(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+
+	options := configsync.Options{
+		WorkDir: workDir,
+		Commands: []configsync.CommandType{
+			{
+				ExePath:   "/bin/bash",
+				Arguments: []string{"-c", "sleep 30 & sleep 30"},
+				FilePath:  "/slow",
+				Timeout:   200 * time.Millisecond,
+			},
+		},
+		Git: gitOptions,
+	}
+
+	start := time.Now()
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Command was not killed after timeout, took %s", elapsed)
+	}
+	if len(report.Commands) != 1 || !report.Commands[0].TimedOut {
+		t.Errorf("Expected command to time out: %+v", report.Commands)
+	}
+	if len(report.Failed) != 1 || !errors.Is(report.Failed[0].Error, configsync.ErrCommandTimeout) {
+		t.Errorf("Expected timeout to be recorded as a failure: %+v", report.Failed)
+	}
+}
+
+func TestConfigsyncCancelled(t *testing.T) {
+	t.Parallel()
+
+	options := configsync.Options{
+		WorkDir: t.TempDir(),
+		Commands: []configsync.CommandType{
+			{
+				ExePath:   "/bin/sh",
+				Arguments: []string{"-c", "echo hello"},
+				FilePath:  "/hello",
+			},
+			{
+				ExePath:   "/bin/sh",
+				Arguments: []string{"-c", "sleep 30"},
+				FilePath:  "/slow",
+			},
+		},
+		Git: gitOptions,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	report, err := configsync.Run(ctx, options)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the sync to be cancelled but got %v", err)
+	}
+	if report == nil || len(report.Commands) != 2 || !report.Commands[0].Success() || report.Committed {
+		t.Errorf("Expected a partial report of the cancelled sync: %+v", report)
+	}
+}
+
+func TestConfigsyncCommandStderr(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+
+	options := configsync.Options{
+		WorkDir: workDir,
+		Commands: []configsync.CommandType{
+			{
+				ExePath:   "/bin/bash",
+				Arguments: []string{"-c", "echo out; echo err 1>&2"},
+				FilePath:  "/combined",
+				Output:    configsync.CommandOutputCombined,
+			},
+			{
+				ExePath:   "/bin/bash",
+				Arguments: []string{"-c", "echo out; echo err 1>&2"},
+				FilePath:  "/separate",
+				Output:    configsync.CommandOutputSeparate,
+			},
+			{
+				ExePath:    "/bin/bash",
+				Arguments:  []string{"-c", "echo partial; exit 3"},
+				FilePath:   "/snapshot",
+				ExitPolicy: configsync.CommandExitPolicySnapshot,
+			},
+		},
+		Git: gitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if report.HasFailures() {
+		t.Fatalf("Unexpected failures: %+v", report.Failed)
+	}
+
+	expected := map[string]string{
+		"/combined":        "out\nerr\n",
+		"/separate":        "out\n",
+		"/separate.stderr": "err\n",
+		"/snapshot":        "partial\n",
+	}
+	for filePath, content := range expected {
+		data, err := os.ReadFile(path.Join(workDir, filePath))
+		if err != nil {
+			t.Errorf("Error reading command output '%s': %s", filePath, err.Error())
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("Unexpected content of '%s': %q", filePath, data)
+		}
+	}
+	if len(report.Commands) != 3 || report.Commands[2].ExitCode != 3 {
+		t.Errorf("Expected exit status to be recorded: %+v", report.Commands)
+	}
+
+	// A failing command keeps its previous output
+	options.Commands[1].Arguments = []string{"-c", "echo changed; exit 1"}
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Path != "/separate" {
+		t.Errorf("Expected failing command to be recorded as a failure: %+v", report.Failed)
+	}
+	if report.Commands[1].ExitCode != 1 {
+		t.Errorf("Unexpected exit status: %d", report.Commands[1].ExitCode)
+	}
+	if data, _ := os.ReadFile(path.Join(workDir, "separate")); string(data) != "out\n" {
+		t.Errorf("Failing command should not overwrite output: %q", data)
+	}
+	meta, err := os.ReadFile(path.Join(workDir, "configsync_meta.json"))
+	if err != nil {
+		t.Fatalf("Error reading metadata: %s", err.Error())
+	}
+	if !strings.Contains(string(meta), `"Stale": true`) {
+		t.Errorf("Expected failing command output to be marked as stale: %s", meta)
+	}
+	if _, err := os.Stat(path.Join(workDir, "separate.stderr")); err != nil {
+		t.Errorf("Failing command should not remove standard error output")
+	}
+}
+
+func TestConfigsyncShellCommand(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+
+	options := configsync.Options{
+		WorkDir: workDir,
+		Commands: []configsync.CommandType{
+			{
+				Shell:    "printf 'b\\na\\n' | sort; echo $GREETING; pwd",
+				FilePath: "/shell",
+				WorkDir:  tmp,
+				Env:      []string{"GREETING=hello"},
+			},
+			{
+				Shell:            "echo $0",
+				ShellInterpreter: []string{"/bin/bash", "-c"},
+				FilePath:         "/bash",
+			},
+			{
+				Shell:    "echo invalid",
+				ExePath:  "/bin/echo",
+				FilePath: "/invalid",
+			},
+		},
+		Git: gitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Path != "/invalid" {
+		t.Errorf("Expected a command with both a shell and executable to fail: %+v", report.Failed)
+	}
+
+	expected := map[string]string{
+		"/shell": "a\nb\nhello\n" + tmp + "\n",
+		"/bash":  "/bin/bash\n",
+	}
+	for filePath, content := range expected {
+		data, err := os.ReadFile(path.Join(workDir, filePath))
+		if err != nil {
+			t.Errorf("Error reading command output '%s': %s", filePath, err.Error())
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("Unexpected content of '%s': %q", filePath, data)
+		}
+	}
+}
+
+func TestConfigsyncCommandStdin(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	stdinPath := path.Join(t.TempDir(), "query.sql")
+	if err := os.WriteFile(stdinPath, []byte("from file\n"), 0600); err != nil {
+		t.Fatalf("Error writing stdin file: %s", err.Error())
+	}
+
+	options := configsync.Options{
+		WorkDir: workDir,
+		Commands: []configsync.CommandType{
+			{
+				ExePath:  "/bin/cat",
+				FilePath: "/inline",
+				Stdin:    "inline\n",
+			},
+			{
+				ExePath:   "/bin/cat",
+				FilePath:  "/file",
+				StdinFile: stdinPath,
+			},
+			{
+				ExePath:   "/bin/cat",
+				FilePath:  "/missing",
+				StdinFile: "/configsync/does/not/exist",
+			},
+		},
+		Git: gitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Path != "/missing" {
+		t.Errorf("Expected missing stdin file to be recorded as a failure: %+v", report.Failed)
+	}
+
+	expected := map[string]string{
+		"/inline": "inline\n",
+		"/file":   "from file\n",
+	}
+	for filePath, content := range expected {
+		data, err := os.ReadFile(path.Join(workDir, filePath))
+		if err != nil {
+			t.Errorf("Error reading command output '%s': %s", filePath, err.Error())
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("Unexpected content of '%s': %q", filePath, data)
+		}
+	}
+}
+
+func TestConfigsyncCommandUser(t *testing.T) {
+	t.Parallel()
+
+	if os.Getuid() != 0 {
+		t.Skip("Must be run as root")
+	}
+
+	workDir := t.TempDir()
+
+	options := configsync.Options{
+		WorkDir: workDir,
+		Commands: []configsync.CommandType{
+			{
+				Shell:      "id -u; id -g; echo $USER",
+				FilePath:   "/id",
+				UserName:   "daemon",
+				SetUserEnv: true,
+			},
+		},
+		Git: gitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if report.HasFailures() {
+		t.Fatalf("Unexpected failures: %+v", report.Failed)
+	}
+
+	data, err := os.ReadFile(path.Join(workDir, "id"))
+	if err != nil {
+		t.Fatalf("Error reading command output: %s", err.Error())
+	}
+	if string(data) != "1\n1\ndaemon\n" {
+		t.Errorf("Command did not run as the user: %q", data)
+	}
+	meta, err := os.ReadFile(path.Join(workDir, "configsync_meta.json"))
+	if err != nil {
+		t.Fatalf("Error reading metadata: %s", err.Error())
+	}
+	if !strings.Contains(string(meta), `"UID": 1,`) || !strings.Contains(string(meta), `"GID": 1`) {
+		t.Errorf("Expected ownership of output to be recorded: %s", meta)
+	}
+}
+
+func TestConfigsyncCommitStrategy(t *testing.T) {
+	t.Parallel()
+
+	for _, strategy := range []string{configsync.CommitStrategyPerSource, configsync.CommitStrategyPerFile} {
+		workDir := t.TempDir()
+		tmp := t.TempDir()
+
+		os.Mkdir(path.Join(tmp, "nginx"), 0755)
+		touchFile(path.Join(tmp, "nginx", "a.conf"))
+		touchFile(path.Join(tmp, "nginx", "b.conf"))
+		touchFile(path.Join(tmp, "postgresql.conf"))
+
+		strategyGitOptions := gitOptions
+		strategyGitOptions.CommitStrategy = strategy
+		strategyGitOptions.MessageTemplate = "{{.Source}}"
+		options := configsync.Options{
+			WorkDir:      workDir,
+			FilePatterns: []string{path.Join(tmp, "nginx"), path.Join(tmp, "postgresql.conf")},
+			Commands: []configsync.CommandType{
+				{
+					ExePath:   "/bin/echo",
+					Arguments: []string{"5432"},
+					FilePath:  "/postgres/port",
+				},
+			},
+			SourceGroups: map[string]string{
+				path.Join(tmp, "nginx"):           "nginx.files",
+				path.Join(tmp, "postgresql.conf"): "postgres.files",
+				"/postgres/port":                  "postgres.files",
+			},
+			Git: strategyGitOptions,
+		}
+		report, err := configsync.Run(context.Background(), options)
+		if err != nil {
+			t.Fatalf("Unexpected error running sync: %s", err.Error())
+		}
+
+		expected := []string{"nginx.files", "postgres.files"}
+		if strategy == configsync.CommitStrategyPerFile {
+			expected = []string{
+				path.Join(tmp, "nginx", "a.conf"),
+				path.Join(tmp, "nginx", "b.conf"),
+				path.Join(tmp, "postgresql.conf"),
+				"/postgres/port",
+			}
+		}
+		if len(report.Commits) != len(expected) || report.CommitHash != report.Commits[len(report.Commits)-1] {
+			t.Errorf("Unexpected commits for %s: %v", strategy, report.Commits)
+		}
+
+		if subjects := strings.Split(runGit(t, workDir, "log", "--reverse", "--format=%s"), "\n"); strings.Join(subjects, ",") != strings.Join(expected, ",") {
+			t.Errorf("Unexpected commits for %s: %v", strategy, subjects)
+		}
+		if status := runGit(t, workDir, "status", "--porcelain"); status != "" {
+			t.Errorf("Expected all changes to be committed for %s: %s", strategy, status)
+		}
+
+		os.Remove(path.Join(tmp, "postgresql.conf"))
+		report, err = configsync.Run(context.Background(), options)
+		if err != nil {
+			t.Fatalf("Unexpected error running sync: %s", err.Error())
+		}
+		if len(report.Commits) != 1 || len(report.Removed) != 1 {
+			t.Errorf("Expected removal to be committed for %s: %v %v", strategy, report.Commits, report.Removed)
+		}
+		if status := runGit(t, workDir, "status", "--porcelain"); status != "" {
+			t.Errorf("Expected all changes to be committed for %s: %s", strategy, status)
+		}
+	}
+}
+
+func TestConfigsyncSignedCommits(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+	altRoot := t.TempDir()
+
+	keyPath := path.Join(tmp, "key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "configsync", "-f", keyPath).CombinedOutput(); err != nil {
+		t.Fatalf("Error generating key: %s %s", err.Error(), out)
+	}
+	publicKey, _ := os.ReadFile(keyPath + ".pub")
+	allowedSignersPath := path.Join(tmp, "allowed_signers")
+	os.WriteFile(allowedSignersPath, append([]byte("configsync "), publicKey...), 0644)
+
+	filePath := path.Join(tmp, "signed.txt")
+	os.WriteFile(filePath, []byte("one"), 0644)
+
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{filePath},
+		Git:          gitOptions,
+	}
+	unsigned, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	options.Git.SigningFormat = git.SigningFormatSSH
+	options.Git.SigningKey = keyPath
+	options.Git.AllowedSignersFile = allowedSignersPath
+	os.WriteFile(filePath, []byte("two"), 0644)
+	signed, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	verifyOptions := options.Git
+	verifyOptions.SigningKey = ""
+	verifyOptions.VerifySignatures = configsync.SignatureVerifyRequire
+	restoreOptions := configsync.RestoreOptions{
+		WorkDir: workDir,
+		Git:     verifyOptions,
+		Root:    altRoot,
+	}
+	if _, err := configsync.Restore(context.Background(), restoreOptions); err != nil {
+		t.Errorf("Unexpected error restoring from signed commit: %s", err.Error())
+	}
+
+	restoreOptions.Revision = unsigned.CommitHash
+	if _, err := configsync.Restore(context.Background(), restoreOptions); !errors.Is(err, git.ErrUnsignedCommit) {
+		t.Errorf("Expected restoring from an unsigned commit to be refused: %v", err)
+	}
+
+	restoreOptions.Git.VerifySignatures = configsync.SignatureVerifyWarn
+	report, err := configsync.Restore(context.Background(), restoreOptions)
+	if err != nil {
+		t.Fatalf("Unexpected error restoring: %s", err.Error())
+	}
+	if !errors.Is(report.SignatureWarning, git.ErrUnsignedCommit) || len(report.Restored) != 1 {
+		t.Errorf("Expected unsigned commit to be restored with a warning: %+v", report)
+	}
+
+	verifyReport, err := configsync.Verify(context.Background(), configsync.VerifyOptions{
+		WorkDir: workDir,
+		Git:     verifyOptions,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error verifying commits: %s", err.Error())
+	}
+	if !verifyReport.HasInvalid() || len(verifyReport.Commits) != 2 {
+		t.Fatalf("Unexpected verification report: %+v", verifyReport)
+	}
+	if verifyReport.Commits[0].Hash != signed.CommitHash || verifyReport.Commits[0].Error != nil {
+		t.Errorf("Expected signed commit to be valid: %+v", verifyReport.Commits[0])
+	}
+
+	os.WriteFile(allowedSignersPath, []byte{}, 0644)
+	restoreOptions.Git.VerifySignatures = configsync.SignatureVerifyRequire
+	restoreOptions.Revision = signed.CommitHash
+	if _, err := configsync.Restore(context.Background(), restoreOptions); !errors.Is(err, git.ErrBadSignature) {
+		t.Errorf("Expected restoring from a commit signed by an unknown key to be refused: %v", err)
+	}
+}
+
+func TestConfigsyncRemoteURL(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	remoteDir := path.Join(tmp, "remote.git")
+	runGit(t, tmp, "init", "--bare", remoteDir)
+
+	filePath := path.Join(tmp, "remote.txt")
+	os.WriteFile(filePath, []byte("one"), 0644)
+
+	remoteGitOptions := gitOptions
+	remoteGitOptions.RemoteEnabled = true
+	remoteGitOptions.RemoteURL = remoteDir
+	remoteGitOptions.BranchName = "host1"
+	options := configsync.Options{
+		WorkDir:      t.TempDir(),
+		FilePatterns: []string{filePath},
+		Git:          remoteGitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if !report.Pushed {
+		t.Fatalf("Expected changes to be pushed to the new remote")
+	}
+
+	// A new work directory for the same host picks up the existing branch
+	options.WorkDir = t.TempDir()
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Unchanged) != 1 || report.Committed {
+		t.Errorf("Expected synced files to be restored from the remote: %+v", report)
+	}
+	if upstream := runGit(t, options.WorkDir, "rev-parse", "--abbrev-ref", "host1@{upstream}"); upstream != "origin/host1" {
+		t.Errorf("Expected branch to track the remote: %s", upstream)
+	}
+
+	os.WriteFile(filePath, []byte("two"), 0644)
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if !report.Pushed {
+		t.Errorf("Expected changes to be pushed")
+	}
+	remoteHead := runGit(t, remoteDir, "rev-parse", "host1")
+	if remoteHead != report.CommitHash {
+		t.Errorf("Expected remote to match the latest commit. Expected %s got %s", report.CommitHash, remoteHead)
+	}
+}
+
+func TestConfigsyncFetchError(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	filePath := path.Join(tmp, "fetch.txt")
+	os.WriteFile(filePath, []byte("one"), 0644)
+
+	remoteGitOptions := gitOptions
+	remoteGitOptions.RemoteEnabled = true
+	remoteGitOptions.RemoteURL = path.Join(tmp, "missing.git")
+	remoteGitOptions.BranchName = "host1"
+	options := configsync.Options{
+		WorkDir:      t.TempDir(),
+		FilePatterns: []string{filePath},
+		Git:          remoteGitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if !errors.Is(err, configsync.ErrFetch) {
+		t.Fatalf("Expected a fetch error but got %v", err)
+	}
+	if report == nil || report.FetchError == nil || !report.Committed || report.Pushed {
+		t.Errorf("Expected the changes to be committed but not pushed: %+v", report)
+	}
+}
+
+func TestConfigsyncRemoteDiverged(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	remoteDir := path.Join(tmp, "remote.git")
+	runGit(t, tmp, "init", "--bare", remoteDir)
+
+	filePath := path.Join(tmp, "diverged.txt")
+	os.WriteFile(filePath, []byte("one"), 0644)
+
+	remoteGitOptions := gitOptions
+	remoteGitOptions.RemoteEnabled = true
+	remoteGitOptions.RemoteURL = remoteDir
+	remoteGitOptions.BranchName = "host1"
+	options := configsync.Options{
+		WorkDir:      t.TempDir(),
+		FilePatterns: []string{filePath},
+		Git:          remoteGitOptions,
+	}
+	if _, err := configsync.Run(context.Background(), options); err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	otherWorkDir := t.TempDir()
+	// Another clone moves the remote branch, while the local branch has a commit that was never pushed
+	runGit(t, tmp, "clone", "--branch", "host1", remoteDir, otherWorkDir)
+	os.WriteFile(path.Join(otherWorkDir, "remote_notes.txt"), []byte("remote"), 0644)
+	runGit(t, otherWorkDir, "add", "-A")
+	runGit(t, otherWorkDir, "commit", "-m", "Remote change")
+	runGit(t, otherWorkDir, "push", "origin", "host1")
+	os.WriteFile(path.Join(options.WorkDir, "local_notes.txt"), []byte("local"), 0644)
+	runGit(t, options.WorkDir, "add", "-A")
+	runGit(t, options.WorkDir, "commit", "-m", "Local change")
+
+	os.WriteFile(filePath, []byte("two"), 0644)
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if !report.Diverged || !report.Pushed {
+		t.Errorf("Expected diverged branch to be rebased and pushed: %+v", report)
+	}
+	if _, err := os.Stat(path.Join(options.WorkDir, "remote_notes.txt")); err != nil {
+		t.Errorf("Expected remote changes to be integrated: %s", err.Error())
+	}
+	remoteHead := runGit(t, remoteDir, "rev-parse", "host1")
+	if remoteHead != report.CommitHash {
+		t.Errorf("Expected remote to match the latest commit. Expected %s got %s", report.CommitHash, remoteHead)
+	}
+
+	// Conflicting changes to the same synced file can't be integrated
+	runGit(t, otherWorkDir, "pull", "origin", "host1")
+	os.WriteFile(path.Join(otherWorkDir, filePath), []byte("remote"), 0644)
+	runGit(t, otherWorkDir, "commit", "-am", "Conflicting remote change")
+	runGit(t, otherWorkDir, "push", "origin", "host1")
+	os.WriteFile(path.Join(options.WorkDir, filePath), []byte("local"), 0644)
+	runGit(t, options.WorkDir, "commit", "-am", "Conflicting local change")
+
+	remoteHead = runGit(t, remoteDir, "rev-parse", "host1")
+
+	// The sync is still committed locally, but not pushed
+	os.WriteFile(filePath, []byte("three"), 0644)
+	report, err = configsync.Run(context.Background(), options)
+	if !errors.Is(err, configsync.ErrDiverged) {
+		t.Fatalf("Expected a divergence error but got %v", err)
+	}
+	if report == nil || !report.Diverged || !report.Committed || report.Pushed || !errors.Is(report.PushError, configsync.ErrDiverged) {
+		t.Fatalf("Expected the report to record the divergence: %+v", report)
+	}
+	if status := runGit(t, options.WorkDir, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected the failed rebase to be aborted: %s", status)
+	}
+	if head := runGit(t, options.WorkDir, "rev-parse", "HEAD"); head != report.CommitHash {
+		t.Errorf("Expected the sync to be committed locally: %s", head)
+	}
+	if data, _ := os.ReadFile(path.Join(options.WorkDir, filePath)); string(data) != "three" {
+		t.Errorf("Unexpected synced file contents: %s", data)
+	}
+	if runGit(t, remoteDir, "rev-parse", "host1") != remoteHead {
+		t.Errorf("Expected the remote to be unchanged")
+	}
+}
+
+func TestConfigsyncPushError(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	remoteDir := path.Join(tmp, "remote.git")
+	runGit(t, tmp, "init", "--bare", remoteDir)
+	hook := path.Join(remoteDir, "hooks", "pre-receive")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\necho rejected >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Error writing hook: %s", err.Error())
+	}
+
+	filePath := path.Join(tmp, "push.txt")
+	os.WriteFile(filePath, []byte("one"), 0644)
+
+	remoteGitOptions := gitOptions
+	remoteGitOptions.RemoteEnabled = true
+	remoteGitOptions.RemoteURL = remoteDir
+	remoteGitOptions.BranchName = "host1"
+	options := configsync.Options{
+		WorkDir:      t.TempDir(),
+		FilePatterns: []string{filePath},
+		Git:          remoteGitOptions,
+		Tag:          "rejected",
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err == nil {
+		t.Fatalf("Expected an error pushing to the remote")
+	}
+	if report == nil || !report.Committed || report.Pushed || report.PushError == nil {
+		t.Fatalf("Expected the report to record the failed push: %+v", report)
+	}
+	if report.Tag != "rejected" {
+		t.Errorf("Expected the tag to be made locally: %+v", report)
+	}
+	if tag := runGit(t, options.WorkDir, "rev-parse", "rejected^{commit}"); tag != report.CommitHash {
+		t.Errorf("Unexpected tagged commit: %s", tag)
+	}
+}
+
+func TestConfigsyncRemoteDivergedSigned(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	tmp := t.TempDir()
+	keyPath := path.Join(tmp, "key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "configsync", "-f", keyPath).CombinedOutput(); err != nil {
+		t.Fatalf("Error generating key: %s %s", err.Error(), out)
+	}
+	publicKey, _ := os.ReadFile(keyPath + ".pub")
+	allowedSignersPath := path.Join(tmp, "allowed_signers")
+	os.WriteFile(allowedSignersPath, append([]byte("configsync "), publicKey...), 0644)
+
+	for _, strategy := range []string{configsync.PullStrategyRebase, configsync.PullStrategyMerge} {
+		remoteDir := path.Join(tmp, strategy+".git")
+		runGit(t, tmp, "init", "--bare", remoteDir)
+		filePath := path.Join(tmp, strategy+".txt")
+		os.WriteFile(filePath, []byte("one"), 0644)
+
+		remoteGitOptions := gitOptions
+		remoteGitOptions.RemoteEnabled = true
+		remoteGitOptions.RemoteURL = remoteDir
+		remoteGitOptions.BranchName = "host1"
+		remoteGitOptions.PullStrategy = strategy
+		remoteGitOptions.SigningFormat = git.SigningFormatSSH
+		remoteGitOptions.SigningKey = keyPath
+		remoteGitOptions.AllowedSignersFile = allowedSignersPath
+		options := configsync.Options{
+			WorkDir:      t.TempDir(),
+			FilePatterns: []string{filePath},
+			Git:          remoteGitOptions,
+		}
+		if _, err := configsync.Run(context.Background(), options); err != nil {
+			t.Fatalf("Unexpected error running sync: %s", err.Error())
+		}
+
+		otherWorkDir := t.TempDir()
+		runGit(t, tmp, "clone", "--branch", "host1", remoteDir, otherWorkDir)
+		os.WriteFile(path.Join(otherWorkDir, "remote_notes.txt"), []byte("remote"), 0644)
+		runGit(t, otherWorkDir, "add", "-A")
+		runGit(t, otherWorkDir, "commit", "-m", "Remote change")
+		runGit(t, otherWorkDir, "push", "origin", "host1")
+		remoteCommit := runGit(t, otherWorkDir, "rev-parse", "HEAD")
+		os.WriteFile(path.Join(options.WorkDir, "local_notes.txt"), []byte("local"), 0644)
+		runGit(t, options.WorkDir, "add", "-A")
+		runGit(t, options.WorkDir, "commit", "-m", "Local change")
+
+		os.WriteFile(filePath, []byte("two"), 0644)
+		report, err := configsync.Run(context.Background(), options)
+		if err != nil {
+			t.Fatalf("Unexpected error running sync with %s: %s", strategy, err.Error())
+		}
+		if !report.Diverged || !report.Pushed {
+			t.Errorf("Expected diverged branch to be integrated and pushed with %s: %+v", strategy, report)
+		}
+
+		// Every commit made or rewritten by integrating the remote branch is signed. Merging leaves the unsigned local
+		// commit as it was.
+		signatures := runGit(t, options.WorkDir, "-c", "gpg.ssh.allowedSignersFile="+allowedSignersPath, "log", "--format=%G? %s", remoteCommit+"..HEAD")
+		for _, line := range strings.Split(signatures, "\n") {
+			if strategy == configsync.PullStrategyMerge && strings.HasSuffix(line, "Local change") {
+				continue
+			}
+			if !strings.HasPrefix(line, "G ") {
+				t.Errorf("Expected commit to be signed with %s: %s", strategy, line)
+			}
+		}
+	}
+}
+
+func TestConfigsyncNativeBackend(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+	touchFile(path.Join(tmp, "1.txt"))
+	touchFile(path.Join(tmp, "2.txt"))
+
+	nativeGitOptions := configsync.GitOptionsType{
+		Backend:    configsync.GitBackendNative,
+		BranchName: "host1",
+	}
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{path.Join(tmp, "*.txt")},
+		Commands: []configsync.CommandType{
+			{
+				ExePath:   "/bin/sh",
+				Arguments: []string{"-c", "echo hello"},
+				FilePath:  "/hello",
+			},
+		},
+		Git: nativeGitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Added) != 3 || !report.Committed {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	os.Remove(path.Join(tmp, "2.txt"))
+	touchFile(path.Join(tmp, "1.txt"))
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Updated) != 1 || len(report.Removed) != 1 || !report.Committed {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	// The repository can be used with the git binary
+	for _, args := range [][]string{{"fsck", "--strict"}, {"status", "--porcelain"}} {
+		if out := runGit(t, workDir, args...); out != "" {
+			t.Errorf("Unexpected output from git %v: %s", args, out)
+		}
+	}
+	if commits := strings.Fields(runGit(t, workDir, "log", "--format=%H", "host1")); len(commits) != 2 || commits[0] != report.CommitHash {
+		t.Errorf("Unexpected commits: %v", commits)
+	}
+
+	nativeGitOptions.RemoteEnabled = true
+	options.Git = nativeGitOptions
+	if _, err := configsync.Run(context.Background(), options); !errors.Is(err, git.ErrUnsupported) {
+		t.Errorf("Expected remotes to be unsupported but got %v", err)
+	}
+}
+
+func TestConfigsyncTags(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	remoteDir := path.Join(tmp, "remote.git")
+	runGit(t, tmp, "init", "--bare", remoteDir)
+	remoteTag := func(tag string) string {
+		return runGit(t, remoteDir, "rev-parse", tag+"^{commit}")
+	}
+
+	filePath := path.Join(tmp, "tag.txt")
+	os.WriteFile(filePath, []byte("one"), 0644)
+
+	tagGitOptions := gitOptions
+	tagGitOptions.RemoteEnabled = true
+	tagGitOptions.RemoteURL = remoteDir
+	tagGitOptions.BranchName = "host1"
+	options := configsync.Options{
+		WorkDir:      t.TempDir(),
+		FilePatterns: []string{filePath},
+		Git:          tagGitOptions,
+		Tag:          `pre-upgrade-{{.Time.Format "2006-01-02"}}`,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	preUpgrade := "pre-upgrade-" + time.Now().Format("2006-01-02")
+	if report.Tag != preUpgrade {
+		t.Errorf("Unexpected tag: %s", report.Tag)
+	}
+	if remoteTag(preUpgrade) != report.CommitHash {
+		t.Errorf("Expected tag to be pushed to the remote")
+	}
+
+	// Tags from the template are only made when there are changes
+	options.Tag = ""
+	tagGitOptions.TagTemplate = "sync-{{.Time.UnixNano}}"
+	options.Git = tagGitOptions
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if report.Committed || report.Tag != "" {
+		t.Errorf("Unexpected tag without changes: %+v", report)
+	}
+	os.WriteFile(filePath, []byte("two"), 0644)
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if !strings.HasPrefix(report.Tag, "sync-") || remoteTag(report.Tag) != report.CommitHash {
+		t.Errorf("Expected changes to be tagged: %+v", report)
+	}
+
+	tagReport, err := configsync.Tag(context.Background(), configsync.TagOptions{
+		WorkDir: options.WorkDir,
+		Git:     tagGitOptions,
+		Name:    "checkpoint",
+		Message: "Before maintenance",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error tagging: %s", err.Error())
+	}
+	if !tagReport.Pushed || tagReport.Commit != report.CommitHash || remoteTag("checkpoint") != report.CommitHash {
+		t.Errorf("Unexpected tag report: %+v", tagReport)
+	}
+	if _, err := configsync.Tag(context.Background(), configsync.TagOptions{
+		WorkDir: options.WorkDir,
+		Git:     tagGitOptions,
+		Name:    "checkpoint",
+	}); !errors.Is(err, git.ErrTagExists) {
+		t.Errorf("Expected tag to already exist but got %v", err)
+	}
+
+	tags, err := configsync.ListTags(context.Background(), options.WorkDir, tagGitOptions)
+	if err != nil {
+		t.Fatalf("Unexpected error listing tags: %s", err.Error())
+	}
+	if len(tags) != 3 || tags[0].Name != "checkpoint" || tags[0].Subject != "Before maintenance" {
+		t.Errorf("Unexpected tags: %+v", tags)
+	}
+
+	// Tags can be compared against
+	drift, err := configsync.Drift(context.Background(), configsync.DriftOptions{
+		Options:  options,
+		Revision: preUpgrade,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error detecting drift: %s", err.Error())
+	}
+	if len(drift.Modified) != 1 {
+		t.Errorf("Expected drift from the tagged commit: %+v", drift)
+	}
+}
+
+func TestConfigsyncHistory(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+	key := []byte(randomString(16))
+	fstab := path.Join(tmp, "fstab")
+	secret := path.Join(tmp, "server.key")
+	os.WriteFile(fstab, []byte("one\n"), 0644)
+	os.WriteFile(secret, []byte("private key\n"), 0600)
+
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{fstab, secret},
+		Encryption: configsync.EncryptionOptionsType{
+			Key:      key,
+			Patterns: []string{"*.key"},
+		},
+		Git: gitOptions,
+	}
+	first, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	between := time.Now()
+	time.Sleep(1100 * time.Millisecond)
+	os.WriteFile(fstab, []byte("two\n"), 0644)
+	second, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+
+	historyOptions := configsync.HistoryOptions{
+		WorkDir:       workDir,
+		Git:           gitOptions,
+		Path:          fstab,
+		EncryptionKey: key,
+	}
+	commits, err := configsync.Log(context.Background(), historyOptions)
+	if err != nil {
+		t.Fatalf("Unexpected error getting history: %s", err.Error())
+	}
+	if len(commits) != 2 || commits[0].Hash != second.CommitHash || commits[1].Hash != first.CommitHash {
+		t.Errorf("Unexpected history: %+v", commits)
+	}
+
+	for _, test := range []struct {
+		Revision string
+		At       time.Time
+		Expected string
+		Commit   string
+	}{
+		{Expected: "two\n", Commit: second.CommitHash},
+		{Revision: first.CommitHash, Expected: "one\n", Commit: first.CommitHash},
+		{At: between, Expected: "one\n", Commit: first.CommitHash},
+		{At: time.Now(), Expected: "two\n", Commit: second.CommitHash},
+	} {
+		historyOptions.Revision = test.Revision
+		historyOptions.At = test.At
+		report, err := configsync.Show(context.Background(), historyOptions)
+		if err != nil {
+			t.Errorf("Unexpected error showing file at %s %s: %s", test.Revision, test.At, err.Error())
+			continue
+		}
+		if string(report.Data) != test.Expected || report.Commit != test.Commit {
+			t.Errorf("Unexpected file at %s %s: %s %s", test.Revision, test.At, report.Data, report.Commit)
+		}
+	}
+
+	historyOptions.Revision = ""
+	historyOptions.At = between.Add(-time.Hour)
+	if _, err := configsync.Show(context.Background(), historyOptions); err == nil {
+		t.Errorf("Expected an error showing a file before it was synced")
+	}
+
+	// Encrypted files are decrypted
+	historyOptions.Path = secret
+	historyOptions.At = time.Time{}
+	report, err := configsync.Show(context.Background(), historyOptions)
+	if err != nil {
+		t.Errorf("Unexpected error showing encrypted file: %s", err.Error())
+	} else if string(report.Data) != "private key\n" {
+		t.Errorf("Unexpected encrypted file contents: %s", report.Data)
+	}
+
+	historyOptions.Path = path.Join(tmp, "missing")
+	if _, err := configsync.Log(context.Background(), historyOptions); err == nil {
+		t.Errorf("Expected an error for a file that was never synced")
+	}
+	historyOptions.Path = "relative/path"
+	if _, err := configsync.Log(context.Background(), historyOptions); err == nil {
+		t.Errorf("Expected an error for a relative path")
+	}
+}
+
+func TestConfigsyncMemoryRepository(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+	touchFile(path.Join(tmp, "1.txt"))
+
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{path.Join(tmp, "1.txt")},
+		Git:          gitOptions,
+		Repository:   git.NewMemory(workDir),
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Added) != 1 || !report.Committed {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	firstCommit := report.CommitHash
+
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Unchanged) != 1 || report.Committed {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	touchFile(path.Join(tmp, "1.txt"))
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Updated) != 1 || !report.Committed || report.CommitHash == firstCommit {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	data, err := options.Repository.ShowFile(firstCommit, path.Join(tmp, "1.txt"))
+	if err != nil || len(data) == 0 {
+		t.Errorf("Expected to read the file from the first commit: %v", err)
+	}
+	if _, err := os.Stat(path.Join(workDir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("Expected no .git directory in the work directory")
+	}
+}
+
+func TestConfigsyncBaseBranch(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+	touchFile(path.Join(tmp, "1.txt"))
+
+	revList := func(branch string) []string {
+		return strings.Fields(runGit(t, workDir, "rev-list", branch))
+	}
+
+	baseGitOptions := gitOptions
+	baseGitOptions.BranchName = "base"
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{path.Join(tmp, "*.txt")},
+		Git:          baseGitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	baseCommit := report.CommitHash
+
+	// New host branches start from the base branch
+	touchFile(path.Join(tmp, "2.txt"))
+	hostGitOptions := gitOptions
+	hostGitOptions.BranchName = "host1"
+	hostGitOptions.BaseBranch = "base"
+	options.Git = hostGitOptions
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Added) != 1 || !report.Committed {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if commits := revList("host1"); len(commits) != 2 || commits[1] != baseCommit {
+		t.Errorf("Expected host branch to start from the base branch: %v", commits)
+	}
+
+	// Existing branches are switched to
+	options.Git = baseGitOptions
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Added) != 1 || !report.Committed {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	// Without a base branch new host branches have no history
+	orphanGitOptions := gitOptions
+	orphanGitOptions.BranchName = "host2"
+	options.Git = orphanGitOptions
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Added) != 2 || !report.Committed {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if commits := revList("host2"); len(commits) != 1 {
+		t.Errorf("Expected orphan host branch: %v", commits)
+	}
+}
+
+func TestConfigsyncExclude(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+
+	os.Mkdir(path.Join(tmp, "conf"), 0755)
+	touchFile(path.Join(tmp, "conf", "a.conf"))
+	touchFile(path.Join(tmp, "conf", "b.conf"))
+	touchFile(path.Join(tmp, "conf", "a.conf.rpmnew"))
+
+	options := configsync.Options{
+		WorkDir: workDir,
+		FilePatterns: []string{
+			path.Join(tmp, "conf"),
+		},
+		ExcludePatterns: []string{
+			"*.rpmnew",
+		},
+		Git: gitOptions,
+	}
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Added) != 2 {
+		t.Errorf("Unexpected added files: %v", report.Added)
+	}
+
+	options.ExcludePatterns = append(options.ExcludePatterns, path.Join(tmp, "conf", "b.*"))
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Removed) != 1 || report.Removed[0] != path.Join(tmp, "conf", "b.conf") {
+		t.Errorf("Unexpected removed files: %v", report.Removed)
+	}
+	if _, err := os.Stat(path.Join(workDir, tmp, "conf", "b.conf")); !os.IsNotExist(err) {
+		t.Errorf("Excluded file was not removed from the work directory")
+	}
+}
+
+func TestConfigsyncRedaction(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+
+	filePath := path.Join(tmp, "app.conf")
+	os.WriteFile(filePath, []byte("user=admin\npassword=hunter2\n"), 0644)
+
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{filePath},
+		Commands: []configsync.CommandType{
+			{
+				ExePath:   "/bin/bash",
+				Arguments: []string{"-c", "echo password=hunter2"},
+				FilePath:  "/secret",
+			},
+		},
+		Redaction: configsync.RedactionOptionsType{
+			Key: []byte(randomString(16)),
+			Rules: []configsync.RedactionRuleType{
+				{
+					Files:    []string{"*.conf"},
+					Commands: []string{"/secret"},
+					Patterns: []string{`password=(.*)`},
+				},
+			},
+		},
+		Git: gitOptions,
+	}
+
+	if _, err := configsync.Run(context.Background(), options); err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	for _, syncPath := range []string{path.Join(workDir, filePath), path.Join(workDir, "secret")} {
+		data, _ := os.ReadFile(syncPath)
+		if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "password=<redacted:") {
+			t.Errorf("Secret was not redacted from '%s': %s", syncPath, data)
+		}
+	}
+
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Unchanged) != 2 {
+		t.Errorf("Redacted files should be unchanged when the secret is unchanged: %+v", report)
+	}
+
+	os.WriteFile(filePath, []byte("user=admin\npassword=hunter3\n"), 0644)
+	report, err = configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if len(report.Updated) != 1 || report.Updated[0] != filePath {
+		t.Errorf("Changing a secret should update the redacted file: %+v", report)
+	}
+}
+
+func TestConfigsyncEncryption(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	tmp := t.TempDir()
+	altRoot := t.TempDir()
+
+	key := []byte(randomString(16))
+	filePath := path.Join(tmp, "server.key")
+	os.WriteFile(filePath, []byte("private key\n"), 0600)
+
+	options := configsync.Options{
+		WorkDir:      workDir,
+		FilePatterns: []string{filePath},
+		Encryption: configsync.EncryptionOptionsType{
+			Key:      key,
+			Patterns: []string{"*.key"},
+		},
+		Git: gitOptions,
+	}
+
+	if _, err := configsync.Run(context.Background(), options); err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	data, _ := os.ReadFile(path.Join(workDir, filePath))
+	if strings.Contains(string(data), "private key") {
+		t.Errorf("Synced file was not encrypted: %s", data)
+	}
+
+	report, err := configsync.Run(context.Background(), options)
+	if err != nil {
+		t.Fatalf("Unexpected error running sync: %s", err.Error())
+	}
+	if report.Committed || len(report.Unchanged) != 1 {
+		t.Errorf("Unchanged encrypted file should not be rewritten: %+v", report)
+	}
+
+	drift, err := configsync.Drift(context.Background(), configsync.DriftOptions{Options: options})
+	if err != nil {
+		t.Fatalf("Unexpected error checking drift: %s", err.Error())
+	}
+	if drift.HasDrift() {
+		t.Errorf("Unexpected drift: %s", drift.Diff)
+	}
+
+	os.WriteFile(filePath, []byte("new private key\n"), 0600)
+	drift, err = configsync.Drift(context.Background(), configsync.DriftOptions{Options: options})
+	if err != nil {
+		t.Fatalf("Unexpected error checking drift: %s", err.Error())
+	}
+	if len(drift.Modified) != 1 || strings.Contains(drift.Diff, "private key") {
+		t.Errorf("Unexpected drift for encrypted file: %s", drift.Diff)
+	}
+
+	restore, err := configsync.Restore(context.Background(), configsync.RestoreOptions{
+		WorkDir:       workDir,
+		Git:           gitOptions,
+		Root:          altRoot,
+		EncryptionKey: key,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error restoring: %s", err.Error())
+	}
+	if len(restore.Restored) != 1 {
+		t.Errorf("Unexpected restore result: %+v", restore)
+	}
+	data, _ = os.ReadFile(path.Join(altRoot, filePath))
+	if string(data) != "private key\n" {
+		t.Errorf("Unexpected restored content: %s", data)
+	}
+}
@@ -0,0 +1,139 @@
+package configsync
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// commandCredentialT describes the user and groups a command runs as
+type commandCredentialT struct {
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+	// The account the command runs as, if it could be resolved
+	User *user.User
+}
+
+// credential resolve the user and groups the command runs as. Returns nil if the command runs as the current user.
+func (c CommandType) credential() (*commandCredentialT, error) {
+	if c.User != nil && c.UserName != "" {
+		return nil, fmt.Errorf("only one of a user ID or user name may be specified")
+	}
+	if c.Group != nil && c.GroupName != "" {
+		return nil, fmt.Errorf("only one of a group ID or group name may be specified")
+	}
+	if c.User == nil && c.UserName == "" && c.Group == nil && c.GroupName == "" && len(c.Groups) == 0 && !c.SetUserEnv {
+		return nil, nil
+	}
+
+	credential := &commandCredentialT{
+		UID: uint32(os.Getuid()),
+		GID: uint32(os.Getgid()),
+	}
+	hasUser := false
+	if c.UserName != "" {
+		u, err := user.Lookup(c.UserName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up user '%s': %s", c.UserName, err.Error())
+		}
+		credential.User = u
+		hasUser = true
+	} else if c.User != nil {
+		credential.UID = *c.User
+		u, err := user.LookupId(strconv.FormatUint(uint64(*c.User), 10))
+		if err == nil {
+			credential.User = u
+		} else if c.SetUserEnv {
+			return nil, fmt.Errorf("error looking up user %d: %s", *c.User, err.Error())
+		}
+		hasUser = true
+	}
+
+	if credential.User != nil {
+		uid, err := parseID(credential.User.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID '%s': %s", credential.User.Uid, err.Error())
+		}
+		credential.UID = uid
+		if c.Group == nil && c.GroupName == "" {
+			gid, err := parseID(credential.User.Gid)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group ID '%s': %s", credential.User.Gid, err.Error())
+			}
+			credential.GID = gid
+		}
+	} else if hasUser && c.Group == nil && c.GroupName == "" {
+		return nil, fmt.Errorf("a group is required for user %d because it has no account", credential.UID)
+	}
+
+	if c.GroupName != "" {
+		gid, err := lookupGroupID(c.GroupName)
+		if err != nil {
+			return nil, err
+		}
+		credential.GID = gid
+	} else if c.Group != nil {
+		credential.GID = *c.Group
+	}
+
+	if c.SetUserEnv && credential.User == nil {
+		return nil, fmt.Errorf("a user is required to set the user environment")
+	}
+
+	if len(c.Groups) > 0 {
+		for _, group := range c.Groups {
+			gid, err := lookupGroupID(group)
+			if err != nil {
+				return nil, err
+			}
+			credential.Groups = append(credential.Groups, gid)
+		}
+	} else if credential.User != nil {
+		groupIDs, err := credential.User.GroupIds()
+		if err != nil {
+			log.Warn("Unable to look up groups for user '%s': %s", credential.User.Username, err.Error())
+		}
+		for _, groupID := range groupIDs {
+			gid, err := parseID(groupID)
+			if err != nil {
+				continue
+			}
+			credential.Groups = append(credential.Groups, gid)
+		}
+	}
+
+	return credential, nil
+}
+
+// environment set the user environment variables on env
+func (c *commandCredentialT) environment(env []string) []string {
+	if c == nil || c.User == nil {
+		return env
+	}
+	env = setEnv(env, "HOME", c.User.HomeDir)
+	env = setEnv(env, "USER", c.User.Username)
+	env = setEnv(env, "LOGNAME", c.User.Username)
+	return env
+}
+
+// lookupGroupID get the ID of the group, which may be a name or a numeric ID
+func lookupGroupID(group string) (uint32, error) {
+	if gid, err := parseID(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("error looking up group '%s': %s", group, err.Error())
+	}
+	return parseID(g.Gid)
+}
+
+func parseID(id string) (uint32, error) {
+	value, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(value), nil
+}
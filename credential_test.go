@@ -0,0 +1,59 @@
+package configsync
+
+import (
+	"os/user"
+	"testing"
+)
+
+func TestCommandCredential(t *testing.T) {
+	if _, err := user.Lookup("daemon"); err != nil {
+		t.Skip("No daemon user on this system")
+	}
+
+	credential, err := CommandType{}.credential()
+	if err != nil || credential != nil {
+		t.Errorf("Expected no credential without a user or group: %+v %v", credential, err)
+	}
+
+	root := uint32(0)
+	credential, err = CommandType{User: &root, Group: &root}.credential()
+	if err != nil {
+		t.Fatalf("Unexpected error resolving credential: %s", err.Error())
+	}
+	if credential == nil || credential.UID != 0 || credential.GID != 0 {
+		t.Errorf("Expected root to be selectable: %+v", credential)
+	}
+
+	credential, err = CommandType{UserName: "daemon", SetUserEnv: true}.credential()
+	if err != nil {
+		t.Fatalf("Unexpected error resolving credential: %s", err.Error())
+	}
+	if credential.UID != 1 || credential.GID != 1 {
+		t.Errorf("Unexpected UID and GID: %d %d", credential.UID, credential.GID)
+	}
+	env := credential.environment([]string{"HOME=/root", "PATH=/bin"})
+	if len(env) != 4 || env[0] != "PATH=/bin" || env[1] != "HOME="+credential.User.HomeDir || env[2] != "USER=daemon" {
+		t.Errorf("Unexpected environment: %v", env)
+	}
+
+	credential, err = CommandType{UserName: "daemon", GroupName: "root", Groups: []string{"daemon", "0"}}.credential()
+	if err != nil {
+		t.Fatalf("Unexpected error resolving credential: %s", err.Error())
+	}
+	if credential.GID != 0 || len(credential.Groups) != 2 || credential.Groups[0] != 1 || credential.Groups[1] != 0 {
+		t.Errorf("Unexpected groups: %d %v", credential.GID, credential.Groups)
+	}
+
+	invalid := []CommandType{
+		{User: &root, UserName: "root"},
+		{Group: &root, GroupName: "root"},
+		{UserName: "configsync-does-not-exist"},
+		{GroupName: "configsync-does-not-exist"},
+		{SetUserEnv: true},
+	}
+	for _, command := range invalid {
+		if _, err := command.credential(); err == nil {
+			t.Errorf("Expected error resolving credential for %+v", command)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package configsync
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+// diffMaxCells is the largest number of line comparisons made when diffing two files. Files larger than this are
+// shown as a complete replacement.
+const diffMaxCells = 16 * 1024 * 1024
+
+type diffOp int
+
+const (
+	diffOpEqual diffOp = iota
+	diffOpDelete
+	diffOpInsert
+)
+
+type diffLine struct {
+	Op   diffOp
+	Text string
+}
+
+// unifiedDiff return a unified diff between from and to, or an empty string if they are equal
+func unifiedDiff(fromName, toName string, from, to []byte) string {
+	if bytes.Equal(from, to) {
+		return ""
+	}
+
+	header := fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName)
+	if isBinary(from) || isBinary(to) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", fromName, toName)
+	}
+
+	lines := diffLines(splitLines(from), splitLines(to))
+	var out strings.Builder
+	out.WriteString(header)
+
+	i := 0
+	for i < len(lines) {
+		for i < len(lines) && lines[i].Op == diffOpEqual {
+			i++
+		}
+		if i >= len(lines) {
+			break
+		}
+
+		// Find the extent of the hunk, merging changes separated by less than twice the context
+		start := max(i-diffContextLines, 0)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != diffOpEqual {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Op == diffOpEqual {
+				next++
+			}
+			if next >= len(lines) || next-end > diffContextLines*2 {
+				end = min(end+diffContextLines, len(lines))
+				break
+			}
+			end = next
+		}
+
+		fromStart, toStart := 1, 1
+		for _, line := range lines[:start] {
+			if line.Op != diffOpInsert {
+				fromStart++
+			}
+			if line.Op != diffOpDelete {
+				toStart++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.Op != diffOpInsert {
+				fromCount++
+			}
+			if line.Op != diffOpDelete {
+				toCount++
+			}
+		}
+		if fromCount == 0 {
+			fromStart--
+		}
+		if toCount == 0 {
+			toStart--
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(fromStart, fromCount), hunkRange(toStart, toCount))
+		for _, line := range lines[start:end] {
+			switch line.Op {
+			case diffOpEqual:
+				out.WriteString(" ")
+			case diffOpDelete:
+				out.WriteString("-")
+			case diffOpInsert:
+				out.WriteString("+")
+			}
+			out.WriteString(line.Text)
+			if !strings.HasSuffix(line.Text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// splitLines split data into lines, keeping the line terminator
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines produce an edit script between from and to using the longest common subsequence of lines
+func diffLines(from, to []string) []diffLine {
+	// Trim the common prefix and suffix to keep the table small
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(from)+len(to))
+	for _, line := range from[:prefix] {
+		lines = append(lines, diffLine{diffOpEqual, line})
+	}
+
+	a := from[prefix : len(from)-suffix]
+	b := to[prefix : len(to)-suffix]
+	if len(a)*len(b) > diffMaxCells {
+		for _, line := range a {
+			lines = append(lines, diffLine{diffOpDelete, line})
+		}
+		for _, line := range b {
+			lines = append(lines, diffLine{diffOpInsert, line})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(a) && j < len(b) {
+			if a[i] == b[j] {
+				lines = append(lines, diffLine{diffOpEqual, a[i]})
+				i++
+				j++
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lines = append(lines, diffLine{diffOpDelete, a[i]})
+				i++
+			} else {
+				lines = append(lines, diffLine{diffOpInsert, b[j]})
+				j++
+			}
+		}
+		for ; i < len(a); i++ {
+			lines = append(lines, diffLine{diffOpDelete, a[i]})
+		}
+		for ; j < len(b); j++ {
+			lines = append(lines, diffLine{diffOpInsert, b[j]})
+		}
+	}
+
+	for _, line := range from[len(from)-suffix:] {
+		lines = append(lines, diffLine{diffOpEqual, line})
+	}
+	return lines
+}
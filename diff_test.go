@@ -0,0 +1,44 @@
+package configsync
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	to := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16"
+	expected := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -13,3 +13,4 @@
+ 13
+ 14
+ 15
++16
+\ No newline at end of file
+`
+	result := unifiedDiff("a", "b", []byte(from), []byte(to))
+	if result != expected {
+		t.Errorf("Unexpected diff. Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	if unifiedDiff("a", "b", []byte(from), []byte(from)) != "" {
+		t.Errorf("Diff of equal content should be empty")
+	}
+
+	expected = `--- a
++++ b
+@@ -0,0 +1,2 @@
++1
++2
+`
+	result = unifiedDiff("a", "b", nil, []byte("1\n2\n"))
+	if result != expected {
+		t.Errorf("Unexpected diff. Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
@@ -0,0 +1,172 @@
+package configsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DriftOptions describes the options for detecting drift
+type DriftOptions struct {
+	Options
+	// The revision (commit hash, branch, or tag) to compare against. If empty, the host branch is used.
+	Revision string
+}
+
+// DriftReport describes the differences between the live system and a committed snapshot
+type DriftReport struct {
+	// The revision that was compared against
+	Revision string
+	// Paths of files or command outputs that exist on the system but not in the snapshot
+	Added []string
+	// Paths of files or command outputs that differ from the snapshot
+	Modified []string
+	// Paths of files or command outputs that are in the snapshot but no longer exist or are no longer configured
+	Removed []string
+	// Files or commands that could not be checked
+	Failed []FailureType
+	// Unified diff of all changes
+	Diff string
+}
+
+// HasDrift does the live system differ from the snapshot
+func (d *DriftReport) HasDrift() bool {
+	return len(d.Added) > 0 || len(d.Modified) > 0 || len(d.Removed) > 0
+}
+
+func (d *DriftReport) fail(filePath string, err error) {
+	d.Failed = append(d.Failed, FailureType{
+		Path:  filePath,
+		Error: err,
+	})
+}
+
+// Drift compare the live filesystem and fresh command outputs against the last committed snapshot. Nothing is written
+// to the work directory.
+func Drift(ctx context.Context, options DriftOptions) (*DriftReport, error) {
+	revision := options.Git.hostRevision(options.Revision)
+	report := &DriftReport{
+		Revision: revision,
+	}
+
+	redactor, err := options.Redaction.redactor()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypter, err := options.Encryption.encrypter()
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := options.Git.openGit(options.WorkDir, options.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("error opening git instance: %s", err.Error())
+	}
+	metadata, err := loadMetaAtRevision(g, revision)
+	if err != nil {
+		return nil, err
+	}
+	committedFiles := map[string]fileType{}
+	for _, file := range metadata.Files {
+		committedFiles[file.Path] = file
+	}
+
+	plan, err := buildPlan(ctx, options.Options, metadata, redactor, encrypter)
+	if err != nil {
+		return nil, err
+	}
+	report.Failed = append(report.Failed, plan.Failed...)
+
+	var diff strings.Builder
+	committedContent := func(filePath string) ([]byte, bool) {
+		data, err := g.ShowFile(revision, filePath)
+		if err != nil {
+			report.fail(filePath, fmt.Errorf("error reading committed file: %s", err.Error()))
+			return nil, false
+		}
+		return data, true
+	}
+
+	for _, plannedFile := range plan.files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		file := plannedFile.File
+		committed, isCommitted := committedFiles[file.Path]
+		if isCommitted && committed.Hash == file.Hash {
+			continue
+		}
+
+		live, err := readSourceFile(file.Path, redactor)
+		if err != nil {
+			report.fail(file.Path, err)
+			continue
+		}
+		if !isCommitted {
+			report.Added = append(report.Added, file.Path)
+			diff.WriteString(driftDiff("/dev/null", "b"+file.Path, nil, live, file.Encrypted))
+			continue
+		}
+
+		data, ok := committedContent(file.Path)
+		if !ok {
+			continue
+		}
+		report.Modified = append(report.Modified, file.Path)
+		diff.WriteString(driftDiff("a"+file.Path, "b"+file.Path, data, live, file.Encrypted || committed.Encrypted))
+	}
+
+	for _, command := range options.Commands {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err := runCommand(ctx, command)
+		if err != nil {
+			report.fail(command.FilePath, err)
+			continue
+		}
+		for _, output := range result.outputs(command) {
+			live := redactor.redact(output.Data, redactor.forCommand(command.FilePath))
+			encrypted := encrypter.shouldEncrypt(command.FilePath) || encrypter.shouldEncrypt(output.FilePath)
+			committed, isCommitted := committedFiles[output.FilePath]
+			if isCommitted && committed.Source == fileSourceCommand && committed.Hash == hashBytes(live) {
+				continue
+			}
+			if !isCommitted {
+				report.Added = append(report.Added, output.FilePath)
+				diff.WriteString(driftDiff("/dev/null", "b"+output.FilePath, nil, live, encrypted))
+				continue
+			}
+
+			data, ok := committedContent(output.FilePath)
+			if !ok {
+				continue
+			}
+			report.Modified = append(report.Modified, output.FilePath)
+			diff.WriteString(driftDiff("a"+output.FilePath, "b"+output.FilePath, data, live, encrypted || committed.Encrypted))
+		}
+	}
+
+	for _, file := range plan.remove {
+		data, ok := committedContent(file.Path)
+		if !ok {
+			continue
+		}
+		report.Removed = append(report.Removed, file.Path)
+		diff.WriteString(driftDiff("a"+file.Path, "/dev/null", data, nil, file.Encrypted))
+	}
+
+	report.Diff = diff.String()
+	return report, nil
+}
+
+// driftDiff return a unified diff of the changes. The contents of encrypted files are never included.
+func driftDiff(fromName, toName string, from, to []byte, encrypted bool) string {
+	if encrypted {
+		return fmt.Sprintf("Encrypted files %s and %s differ\n", fromName, toName)
+	}
+	return unifiedDiff(fromName, toName, from, to)
+}
@@ -0,0 +1,110 @@
+package configsync
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// EncryptionOptionsType describes the options for encrypting sensitive files before they are written to the work
+// directory
+type EncryptionOptionsType struct {
+	// The AES-256 key, either as 32 raw bytes or 64 hexadecimal characters. Required if any patterns are defined.
+	Key []byte
+	// Glob patterns of files and command outputs to encrypt. Follows the same matching rules as exclude patterns.
+	Patterns []string
+}
+
+// encryptedFileMagic is written at the start of every encrypted file
+var encryptedFileMagic = []byte("configsync-aes256gcm-v1\n")
+
+type encrypterT struct {
+	aead     cipher.AEAD
+	patterns []string
+}
+
+// encrypter prepare the cipher. Returns nil if there is no key and no patterns.
+func (o EncryptionOptionsType) encrypter() (*encrypterT, error) {
+	if len(o.Key) == 0 {
+		if len(o.Patterns) > 0 {
+			return nil, fmt.Errorf("an encryption key is required to encrypt files")
+		}
+		return nil, nil
+	}
+
+	key, err := parseEncryptionKey(o.Key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %s", err.Error())
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %s", err.Error())
+	}
+
+	return &encrypterT{
+		aead:     aead,
+		patterns: o.Patterns,
+	}, nil
+}
+
+func parseEncryptionKey(key []byte) ([]byte, error) {
+	key = bytes.TrimSpace(key)
+	if len(key) == 64 {
+		decoded, err := hex.DecodeString(string(key))
+		if err == nil {
+			return decoded, nil
+		}
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid encryption key: must be 32 bytes or 64 hexadecimal characters")
+	}
+	return key, nil
+}
+
+// shouldEncrypt does the file match any of the encryption patterns
+func (e *encrypterT) shouldEncrypt(filePath string) bool {
+	if e == nil {
+		return false
+	}
+	return matchesAnyPattern(filePath, e.patterns)
+}
+
+// encrypt the contents of the file. The file path is authenticated so encrypted files can't be swapped.
+func (e *encrypterT) encrypt(filePath string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(encryptedFileMagic)+len(nonce)+len(plaintext)+e.aead.Overhead())
+	out = append(out, encryptedFileMagic...)
+	out = append(out, nonce...)
+	return e.aead.Seal(out, nonce, plaintext, []byte(filePath)), nil
+}
+
+// decrypt the contents of the file
+func (e *encrypterT) decrypt(filePath string, data []byte) ([]byte, error) {
+	if e == nil {
+		return nil, fmt.Errorf("an encryption key is required to decrypt files")
+	}
+	if !bytes.HasPrefix(data, encryptedFileMagic) {
+		return nil, fmt.Errorf("file is not encrypted")
+	}
+	data = data[len(encryptedFileMagic):]
+	if len(data) < e.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+	nonce := data[:e.aead.NonceSize()]
+	plaintext, err := e.aead.Open(nil, nonce, data[e.aead.NonceSize():], []byte(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting file: %s", err.Error())
+	}
+	return plaintext, nil
+}
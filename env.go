@@ -0,0 +1,97 @@
+package configsync
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// CommandEnvInherit start with the environment of configsync and add or override the command's variables. This is
+	// the default.
+	CommandEnvInherit = "inherit"
+	// CommandEnvReplace use only the command's variables
+	CommandEnvReplace = "replace"
+	// CommandEnvClean start with a minimal default environment and add or override the command's variables
+	CommandEnvClean = "clean"
+)
+
+// cleanEnv is the minimal environment used for CommandEnvClean
+var cleanEnv = []string{
+	"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	"LANG=C",
+	"LC_ALL=C",
+}
+
+// envReferencePattern matches references to host variables (${env:NAME}) and files (${file:/path}) in values
+var envReferencePattern = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+
+// environment build the environment for the command. Returns nil if the command should inherit the environment of
+// configsync unchanged.
+func (c CommandType) environment() ([]string, error) {
+	var env []string
+	switch c.EnvMode {
+	case "", CommandEnvInherit:
+		if len(c.Env) == 0 {
+			return nil, nil
+		}
+		env = os.Environ()
+	case CommandEnvReplace:
+		env = []string{}
+	case CommandEnvClean:
+		env = append([]string{}, cleanEnv...)
+	default:
+		return nil, fmt.Errorf("invalid environment mode '%s'", c.EnvMode)
+	}
+
+	for _, variable := range c.Env {
+		key, value, ok := strings.Cut(variable, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid environment variable '%s': must be in the format key=value", variable)
+		}
+		expanded, err := expandEnvReferences(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid environment variable '%s': %s", key, err.Error())
+		}
+		env = setEnv(env, key, expanded)
+	}
+	return env, nil
+}
+
+// expandEnvReferences replace references to host variables and files in value
+func expandEnvReferences(value string) (string, error) {
+	var expandErr error
+	expanded := envReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		match := envReferencePattern.FindStringSubmatch(reference)
+		switch match[1] {
+		case "env":
+			hostValue, ok := os.LookupEnv(match[2])
+			if !ok && expandErr == nil {
+				expandErr = fmt.Errorf("host environment variable '%s' is not set", match[2])
+			}
+			return hostValue
+		default:
+			data, err := os.ReadFile(match[2])
+			if err != nil && expandErr == nil {
+				expandErr = fmt.Errorf("error reading file '%s': %s", match[2], err.Error())
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
+// setEnv set key to value in env, replacing any existing value
+func setEnv(env []string, key, value string) []string {
+	out := []string{}
+	for _, variable := range env {
+		if !strings.HasPrefix(variable, key+"=") {
+			out = append(out, variable)
+		}
+	}
+	return append(out, key+"="+value)
+}
@@ -0,0 +1,66 @@
+package configsync
+
+import (
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestCommandEnvironment(t *testing.T) {
+	t.Setenv("CONFIGSYNC_TEST_HOST", "host value")
+	secretPath := path.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretPath, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatalf("Error writing secret: %s", err.Error())
+	}
+
+	env, err := CommandType{}.environment()
+	if err != nil || env != nil {
+		t.Errorf("Expected environment to be inherited unchanged: %v %v", env, err)
+	}
+
+	env, err = CommandType{Env: []string{"LANG=C"}}.environment()
+	if err != nil {
+		t.Fatalf("Unexpected error building environment: %s", err.Error())
+	}
+	if !slices.Contains(env, "PATH="+os.Getenv("PATH")) || env[len(env)-1] != "LANG=C" {
+		t.Errorf("Expected host environment to be inherited: %v", env)
+	}
+
+	env, err = CommandType{
+		EnvMode: CommandEnvReplace,
+		Env:     []string{"HOST=${env:CONFIGSYNC_TEST_HOST}", "PGPASSWORD=${file:" + secretPath + "}", "A=b=c"},
+	}.environment()
+	if err != nil {
+		t.Fatalf("Unexpected error building environment: %s", err.Error())
+	}
+	expected := []string{"HOST=host value", "PGPASSWORD=hunter2", "A=b=c"}
+	if len(env) != len(expected) {
+		t.Fatalf("Unexpected environment: %v", env)
+	}
+	for i := range expected {
+		if env[i] != expected[i] {
+			t.Errorf("Unexpected environment variable. Expected '%s' got '%s'", expected[i], env[i])
+		}
+	}
+
+	env, err = CommandType{EnvMode: CommandEnvClean, Env: []string{"LC_ALL=en_US.UTF-8"}}.environment()
+	if err != nil {
+		t.Fatalf("Unexpected error building environment: %s", err.Error())
+	}
+	if len(env) != 3 || !slices.Contains(env, "LANG=C") || !slices.Contains(env, "LC_ALL=en_US.UTF-8") || slices.Contains(env, "CONFIGSYNC_TEST_HOST=host value") {
+		t.Errorf("Unexpected clean environment: %v", env)
+	}
+
+	invalid := []CommandType{
+		{EnvMode: "bogus"},
+		{Env: []string{"NOVALUE"}},
+		{Env: []string{"A=${env:CONFIGSYNC_TEST_DOES_NOT_EXIST}"}},
+		{Env: []string{"A=${file:/configsync/does/not/exist}"}},
+	}
+	for _, command := range invalid {
+		if _, err := command.environment(); err == nil {
+			t.Errorf("Expected error building environment for %+v", command)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckoutOptions describes where a branch that does not exist locally comes from
+type CheckoutOptions struct {
+	// The remote to look for an existing branch on. The remote must have been fetched.
+	Remote string
+	// The branch that new branches are started from, either a local branch or a branch on Remote. If empty new branches
+	// are orphans with no history.
+	Base string
+}
+
+// branchLookup describes a repository that can check for branches
+type branchLookup interface {
+	BranchExists(branch string) (bool, error)
+	RemoteBranchExists(remote, branch string) (bool, error)
+}
+
+// startPoint get the reference a new branch should start from, or an empty string if it should be an orphan. A local
+// base branch is preferred over one on the remote.
+func (o CheckoutOptions) startPoint(r branchLookup) (string, error) {
+	if o.Base == "" {
+		return "", nil
+	}
+	if exists, err := r.BranchExists(o.Base); err != nil {
+		return "", err
+	} else if exists {
+		return "refs/heads/" + o.Base, nil
+	}
+	if o.Remote != "" {
+		if exists, err := r.RemoteBranchExists(o.Remote, o.Base); err != nil {
+			return "", err
+		} else if exists {
+			return "refs/remotes/" + o.Remote + "/" + o.Base, nil
+		}
+	}
+	return "", fmt.Errorf("base branch '%s' does not exist", o.Base)
+}
+
+// SanitizeBranchName replace any characters in name that are not allowed in a git branch name, such as a hostname,
+// with dashes
+func SanitizeBranchName(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			b.WriteRune('-')
+			continue
+		}
+		b.WriteRune(c)
+	}
+	parts := []string{}
+	for _, part := range strings.Split(b.String(), "/") {
+		part = strings.ReplaceAll(part, "@{", "-{")
+		for strings.Contains(part, "..") {
+			part = strings.ReplaceAll(part, "..", ".")
+		}
+		part = strings.TrimLeft(part, ".")
+		for strings.HasSuffix(part, ".lock") || strings.HasSuffix(part, ".") {
+			part = strings.TrimSuffix(strings.TrimSuffix(part, ".lock"), ".")
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	branch := strings.TrimLeft(strings.Join(parts, "/"), "-")
+	if branch == "" || branch == "@" || branch == "HEAD" {
+		return "configsync"
+	}
+	return branch
+}
+
+// checkRefName check that the name is a valid git reference name
+func checkRefName(name string) error {
+	invalid := name == "" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.HasSuffix(name, ".lock") || strings.Contains(name, "..") || strings.Contains(name, "//") ||
+		strings.Contains(name, "@{") || strings.Contains(name, "/.") || strings.ContainsAny(name, " ~^:?*[\\")
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f {
+			invalid = true
+		}
+	}
+	if invalid {
+		return fmt.Errorf("'%s' is not a valid reference name", name)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCheckout(t *testing.T) {
+	t.Parallel()
+
+	forEachBackend(t, func(t *testing.T, dir string, repo Repository) {
+		commit := func(file, contents string) string {
+			t.Helper()
+			os.WriteFile(path.Join(dir, file), []byte(contents), 0644)
+			if err := repo.Add(dir); err != nil {
+				t.Fatalf("Error adding files: %s", err.Error())
+			}
+			if err := repo.Commit("Update "+file, testAuthor); err != nil {
+				t.Fatalf("Error committing: %s", err.Error())
+			}
+			head, err := repo.HeadCommit()
+			if err != nil {
+				t.Fatalf("Error getting head commit: %s", err.Error())
+			}
+			return *head
+		}
+		checkout := func(branch string, options CheckoutOptions) {
+			t.Helper()
+			if err := repo.Checkout(branch, options); err != nil {
+				t.Fatalf("Error checking out %s: %s", branch, err.Error())
+			}
+			if current, err := repo.CurrentBranch(); err != nil || *current != branch {
+				t.Fatalf("Unexpected current branch: %v %v", current, err)
+			}
+			if hasChanges(t, repo) {
+				t.Fatalf("Unexpected changes after checking out %s", branch)
+			}
+		}
+		exists := func(file string) bool {
+			_, err := os.Lstat(path.Join(dir, file))
+			return err == nil
+		}
+
+		checkout("host1", CheckoutOptions{})
+		host1 := commit("a", "a")
+
+		// New branches without a base have no history or files
+		checkout("host2", CheckoutOptions{})
+		if _, err := repo.HeadCommit(); err == nil {
+			t.Errorf("Expected orphan branch to have no commits")
+		}
+		if exists("a") {
+			t.Errorf("Expected files from the previous branch to be removed")
+		}
+		commit("b", "b")
+
+		checkout("host1", CheckoutOptions{})
+		if !exists("a") || exists("b") {
+			t.Errorf("Unexpected files after switching to existing branch")
+		}
+
+		checkout("host3", CheckoutOptions{Base: "host1"})
+		if head, err := repo.HeadCommit(); err != nil || *head != host1 {
+			t.Errorf("Expected branch to start from base: %v %v", head, err)
+		}
+		if err := repo.Checkout("host4", CheckoutOptions{Base: "missing"}); err == nil {
+			t.Errorf("Expected an error for a missing base branch")
+		}
+
+		runGit(t, dir, "remote", "add", "origin", path.Join(dir, "remote.git"))
+		runGit(t, dir, "update-ref", "refs/remotes/origin/host5", host1)
+		checkout("host5", CheckoutOptions{Remote: "origin", Base: "host2"})
+		if head, err := repo.HeadCommit(); err != nil || *head != host1 {
+			t.Errorf("Expected branch to start from the remote: %v %v", head, err)
+		}
+
+		os.WriteFile(path.Join(dir, "a"), []byte("changed"), 0644)
+		if err := repo.Checkout("host2", CheckoutOptions{}); err == nil {
+			t.Errorf("Expected an error checking out over uncommitted changes")
+		}
+		os.WriteFile(path.Join(dir, "a"), []byte("a"), 0644)
+		checkout("host2", CheckoutOptions{})
+		os.WriteFile(path.Join(dir, "a"), []byte("untracked"), 0644)
+		if err := repo.Checkout("host1", CheckoutOptions{}); err == nil {
+			t.Errorf("Expected an error checking out over an untracked file")
+		}
+		if data, _ := os.ReadFile(path.Join(dir, "a")); string(data) != "untracked" {
+			t.Errorf("Unexpected untracked file contents: %s", data)
+		}
+
+		runGit(t, dir, "fsck", "--strict")
+	})
+}
+
+func TestSanitizeBranchName(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]string{
+		"web01.example.com": "web01.example.com",
+		"my host":           "my-host",
+		"host:1~2^3":        "host-1-2-3",
+		"..hidden..":        "hidden",
+		"host.lock":         "host",
+		"a//b/":             "a/b",
+		"-host":             "host",
+		"at@{1}":            "at-{1}",
+		"...":               "configsync",
+		"":                  "configsync",
+	} {
+		branch := SanitizeBranchName(name)
+		if branch != expected {
+			t.Errorf("Unexpected branch name for '%s': %s", name, branch)
+		}
+		if err := checkRefName("refs/heads/" + branch); err != nil {
+			t.Errorf("Invalid branch name for '%s': %s", name, err.Error())
+		}
+	}
+}
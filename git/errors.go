@@ -0,0 +1,102 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrNotRepository is returned when the directory is not a git repository
+	ErrNotRepository = errors.New("not a git repository")
+	// ErrAuthentication is returned when the remote could not be authenticated with
+	ErrAuthentication = errors.New("authentication failed")
+	// ErrNonFastForward is returned when the remote rejects a push because it has commits the local branch does not
+	ErrNonFastForward = errors.New("push rejected by remote, non-fast-forward")
+	// ErrMergeConflict is returned when a rebase or merge stops because of conflicting changes
+	ErrMergeConflict = errors.New("merge conflict")
+	// ErrNothingToCommit is returned when committing with no changes
+	ErrNothingToCommit = errors.New("nothing to commit")
+)
+
+// Error describes a git command that failed. Use errors.Is to check for ErrNotRepository, ErrAuthentication,
+// ErrNonFastForward, ErrMergeConflict, or ErrNothingToCommit.
+type Error struct {
+	// The arguments the git binary was run with, starting with the git command
+	Args []string
+	// The exit code of git, or -1 if it could not be run
+	ExitCode int
+	// The standard error output of git
+	Stderr string
+	// The standard output of git
+	Stdout string
+
+	kind error
+	err  error
+}
+
+// errorPatterns maps the type of error to messages git prints for it
+var errorPatterns = []struct {
+	kind     error
+	messages []string
+}{
+	{ErrNotRepository, []string{"not a git repository"}},
+	{ErrAuthentication, []string{"authentication failed", "permission denied (publickey", "could not read username", "could not read password", "invalid username or password", "host key verification failed"}},
+	{ErrNonFastForward, []string{"[rejected]", "non-fast-forward", "fetch first", "stale info"}},
+	{ErrMergeConflict, []string{"conflict (", "could not apply", "unmerged files", "resolve all conflicts"}},
+	{ErrNothingToCommit, []string{"nothing to commit", "nothing added to commit", "no changes added to commit"}},
+}
+
+func newError(args []string, stdout, stderr []byte, err error) *Error {
+	gitErr := &Error{
+		Args:     args,
+		ExitCode: -1,
+		Stderr:   string(stderr),
+		Stdout:   string(stdout),
+		err:      err,
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		gitErr.ExitCode = exitErr.ExitCode()
+	}
+	output := strings.ToLower(gitErr.Stderr + "\n" + gitErr.Stdout)
+	for _, pattern := range errorPatterns {
+		for _, message := range pattern.messages {
+			if strings.Contains(output, message) {
+				gitErr.kind = pattern.kind
+				return gitErr
+			}
+		}
+	}
+	return gitErr
+}
+
+func (e *Error) Error() string {
+	command := "git"
+	if len(e.Args) > 0 {
+		command += " " + e.Args[0]
+	}
+	message := strings.TrimSpace(e.Stderr)
+	if message == "" {
+		message = strings.TrimSpace(e.Stdout)
+	}
+	if e.ExitCode < 0 && e.err != nil {
+		return fmt.Sprintf("%s: %s", command, e.err.Error())
+	}
+	if message == "" {
+		return fmt.Sprintf("%s: exit status %d", command, e.ExitCode)
+	}
+	return fmt.Sprintf("%s: exit status %d: %s", command, e.ExitCode, message)
+}
+
+// Unwrap get the type of error and the underlying error from running git
+func (e *Error) Unwrap() []error {
+	errs := []error{}
+	if e.err != nil {
+		errs = append(errs, e.err)
+	}
+	if e.kind != nil {
+		errs = append(errs, e.kind)
+	}
+	return errs
+}
@@ -1,8 +1,12 @@
 package git
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,9 +20,53 @@ var log = logtic.Log.Connect("git")
 type Git struct {
 	gitPath string
 	repoDir string
+	signing *SigningOptions
 }
 
-const minimumGitVersion = 170
+// minimumGitVersion is the oldest version of git that supports everything used, merge --no-edit was added in 1.7.10
+var minimumGitVersion = versionT{1, 7, 10}
+
+// versionT describes a version of git
+type versionT struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// parseVersion parse the output of git version
+func parseVersion(out string) (versionT, error) {
+	match := regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`).FindStringSubmatch(out)
+	if match == nil {
+		return versionT{}, fmt.Errorf("unknown git version: %s", strings.TrimSpace(out))
+	}
+	parts := make([]int, 3)
+	for i, part := range match[1:] {
+		if part == "" {
+			continue
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return versionT{}, fmt.Errorf("unknown git version: %s", match[0])
+		}
+		parts[i] = number
+	}
+	return versionT{parts[0], parts[1], parts[2]}, nil
+}
+
+// less is the version older than other
+func (v versionT) less(other versionT) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v versionT) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
 
 // New initialize a new git instance
 func New(gitBinPath string, repoDir string) (*Git, error) {
@@ -27,45 +75,61 @@ func New(gitBinPath string, repoDir string) (*Git, error) {
 		repoDir: repoDir,
 	}
 
-	version, err := g.Version()
+	version, err := g.version()
 	if err != nil {
 		return nil, err
 	}
-	if *version < minimumGitVersion {
-		return nil, fmt.Errorf("unsupported git version (too old)")
+	if version.less(minimumGitVersion) {
+		return nil, fmt.Errorf("unsupported git version %s, %s or newer is required", version, minimumGitVersion)
 	}
 
 	return &g, nil
 }
 
 func (g *Git) exec(verb string, args ...string) ([]byte, error) {
-	args = append([]string{verb}, args...)
-	log.Debug("exec: %s %v", g.gitPath, strings.Join(args, " "))
-	cmd := exec.Command(g.gitPath, args...)
+	return g.execEnv(nil, verb, args...)
+}
+
+// execEnv run git with the additional environment variables and return its standard output. If git fails the error is
+// an *Error.
+func (g *Git) execEnv(env []string, verb string, args ...string) ([]byte, error) {
+	command := append([]string{verb}, args...)
+	log.Debug("exec: %s %v", g.gitPath, strings.Join(command, " "))
+	cmd := exec.Command(g.gitPath, append(g.signing.config(), command...)...)
 	cmd.Dir = g.repoDir
-	return cmd.CombinedOutput()
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), newError(command, stdout.Bytes(), stderr.Bytes(), err)
+	}
+	return stdout.Bytes(), nil
 }
 
-// Version the git binary version
+// Version the git binary version, encoded as major*10000 + minor*100 + patch so that versions can be compared
 func (g *Git) Version() (*int, error) {
-	out, err := g.exec("version")
+	v, err := g.version()
 	if err != nil {
 		return nil, err
 	}
-	pattern := regexp.MustCompile(`\d+\.\d+\.\d+(\.\d+)?`)
-	versionString := pattern.FindString(string(out))
-	if versionString == "" {
-		return nil, fmt.Errorf("unknown git version: %s", out)
-	}
+	version := v.Major*10000 + v.Minor*100 + v.Patch
+	return &version, nil
+}
 
-	versionString = strings.ReplaceAll(versionString, ".", "")
-	version, err := strconv.Atoi(versionString)
+func (g *Git) version() (versionT, error) {
+	out, err := g.exec("version")
 	if err != nil {
-		return nil, fmt.Errorf("unknown git version: %s", versionString)
+		return versionT{}, err
 	}
-
-	log.Debug("git version: %d", version)
-	return &version, nil
+	version, err := parseVersion(string(out))
+	if err != nil {
+		return versionT{}, err
+	}
+	log.Debug("git version: %s", version)
+	return version, nil
 }
 
 // InitIfNeeded initialize a new repo if needed
@@ -74,6 +138,9 @@ func (g *Git) InitIfNeeded() error {
 	if err == nil {
 		return nil
 	}
+	if !errors.Is(err, ErrNotRepository) {
+		return err
+	}
 	_, err = g.exec("init")
 	if err != nil {
 		return err
@@ -82,67 +149,214 @@ func (g *Git) InitIfNeeded() error {
 	return nil
 }
 
-// CurrentBranch get the current branch
+// CurrentBranch get the current branch, even if it has no commits yet. Returns "HEAD" if HEAD is detached.
 func (g *Git) CurrentBranch() (*string, error) {
-	out, err := g.exec("rev-parse", "--abbrev-ref", "HEAD")
+	out, err := g.exec("symbolic-ref", "-q", "HEAD")
 	if err != nil {
-		return nil, err
+		out, err = g.exec("rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return nil, err
+		}
 	}
 	branch := string(out)
 	branch = strings.ReplaceAll(branch, "\n", "")
+	branch = strings.TrimPrefix(branch, "refs/heads/")
 	return &branch, nil
 }
 
-// Checkout checkout a specific branch
-func (g *Git) Checkout(branch string) error {
+// Checkout checkout a specific branch. An existing local branch is switched to, otherwise the branch is created to
+// track the same branch on the remote if it exists there, or is started from the base branch. Without a base branch
+// the new branch is an orphan and any files tracked by the previous branch are removed.
+func (g *Git) Checkout(branch string, options CheckoutOptions) error {
 	current, err := g.CurrentBranch()
 	if err == nil && branch == *current {
 		return nil
 	}
 
-	_, err = g.exec("checkout", "-b", branch)
+	if exists, err := g.BranchExists(branch); err != nil {
+		return err
+	} else if exists {
+		_, err := g.exec("checkout", branch)
+		return err
+	}
+	if options.Remote != "" {
+		if exists, err := g.RemoteBranchExists(options.Remote, branch); err != nil {
+			return err
+		} else if exists {
+			_, err := g.exec("checkout", "-b", branch, "--track", options.Remote+"/"+branch)
+			return err
+		}
+	}
+	start, err := options.startPoint(g)
 	if err != nil {
 		return err
 	}
-	return nil
+	if start != "" {
+		_, err := g.exec("checkout", "--no-track", "-b", branch, start)
+		return err
+	}
+
+	if _, err := g.HeadCommit(); err != nil {
+		// There are no commits yet, so only HEAD needs to change
+		if err := checkRefName("refs/heads/" + branch); err != nil {
+			return err
+		}
+		_, err := g.exec("symbolic-ref", "HEAD", "refs/heads/"+branch)
+		return err
+	}
+	if _, err := g.exec("checkout", "--orphan", branch); err != nil {
+		return err
+	}
+	_, err = g.exec("rm", "-r", "-f", "-q", "--ignore-unmatch", "--", ".")
+	return err
+}
+
+// BranchExists does the local branch exist
+func (g *Git) BranchExists(branch string) (bool, error) {
+	return g.refExists("refs/heads/" + branch)
+}
+
+// RemoteBranchExists does the remote-tracking branch exist. The remote must have been fetched.
+func (g *Git) RemoteBranchExists(remote, branch string) (bool, error) {
+	return g.refExists("refs/remotes/" + remote + "/" + branch)
+}
+
+// refExists does the reference exist. git exits with status 1 and prints nothing if it doesn't, any other failure is
+// returned as an error.
+func (g *Git) refExists(ref string) (bool, error) {
+	_, err := g.exec("rev-parse", "--verify", "--quiet", ref)
+	var gitErr *Error
+	if errors.As(err, &gitErr) && gitErr.ExitCode == 1 && strings.TrimSpace(gitErr.Stderr) == "" {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RemoteURL get the URL of the remote. Returns an empty string if the remote does not exist.
+func (g *Git) RemoteURL(remote string) (string, error) {
+	out, err := g.exec("config", "--get", "remote."+remote+".url")
+	var gitErr *Error
+	if errors.As(err, &gitErr) && gitErr.ExitCode == 1 {
+		// git config exits with status 1 if the key isn't set
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// SetRemote add the remote, or update its URL if it already exists
+func (g *Git) SetRemote(remote, url string) error {
+	current, err := g.RemoteURL(remote)
+	if err != nil {
+		return err
+	}
+	if current == url {
+		return nil
+	}
+	verb := "set-url"
+	if current == "" {
+		verb = "add"
+	}
+	_, err = g.exec("remote", verb, remote, url)
+	return err
 }
 
-// Pull perform a git pull
-func (g *Git) Pull() error {
-	_, err := g.exec("pull")
+// Fetch perform a git fetch of the remote
+func (g *Git) Fetch(remote string) error {
+	_, err := g.exec("fetch", remote)
+	return err
+}
+
+// Divergence count the commits on local that are not on upstream (ahead) and on upstream that are not on local (behind)
+func (g *Git) Divergence(local, upstream string) (int, int, error) {
+	out, err := g.exec("rev-list", "--left-right", "--count", local+"..."+upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %s", out)
+	}
+	ahead, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %s", out)
+	}
+	behind, err := strconv.Atoi(fields[1])
 	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %s", out)
+	}
+	return ahead, behind, nil
+}
+
+// Rebase rebase the current branch onto upstream. If the rebase fails it is aborted, leaving the branch unchanged.
+// Returns ErrMergeConflict if the changes conflict.
+func (g *Git) Rebase(upstream, author string) error {
+	// The rewritten commits are signed again as rebasing drops their signatures
+	args := append(g.signing.commitArgs(), upstream)
+	_, err := g.execEnv(g.identityEnv(author), "rebase", args...)
+	if err != nil {
+		g.exec("rebase", "--abort")
 		return err
 	}
 	return nil
 }
 
-// Push perform a git push
-func (g *Git) Push(remote, local string) error {
-	_, err := g.exec("push", remote, local)
+// Merge merge upstream into the current branch. If the merge fails it is aborted, leaving the branch unchanged.
+// Returns ErrMergeConflict if the changes conflict.
+func (g *Git) Merge(upstream, author string) error {
+	args := append(g.signing.commitArgs(), "--no-edit", upstream)
+	_, err := g.execEnv(g.identityEnv(author), "merge", args...)
 	if err != nil {
+		g.exec("merge", "--abort")
 		return err
 	}
 	return nil
 }
 
-// Remove perform a git rm -f
+// Push perform a git push, setting the remote branch as the upstream of the local branch. Returns ErrNonFastForward
+// if the remote has commits the local branch does not.
+func (g *Git) Push(remote, local string) error {
+	_, err := g.exec("push", "--set-upstream", remote, local)
+	return err
+}
+
+// RevList get the hashes of the last count commits reachable from revision, oldest first
+func (g *Git) RevList(revision string, count int) ([]string, error) {
+	out, err := g.exec("rev-list", "--reverse", fmt.Sprintf("--max-count=%d", count), revision)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Remove perform a git rm -f, also removing the files that are not tracked from the work tree
 func (g *Git) Remove(filePath ...string) error {
-	args := append([]string{"-f"}, filePath...)
+	args := append([]string{"-f", "--ignore-unmatch", "--"}, filePath...)
 	_, err := g.exec("rm", args...)
 	if err != nil {
 		return err
 	}
+	for _, file := range filePath {
+		if !path.IsAbs(file) {
+			file = path.Join(g.repoDir, file)
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	return nil
 }
 
 // HasChanges does the repo have any unstaged or untracked files
-func (g *Git) HasChanges() bool {
+func (g *Git) HasChanges() (bool, error) {
 	out, err := g.exec("status", "--porcelain")
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	log.Debug("workdir status: %s", out)
-	return len(out) > 1
+	return len(bytes.TrimSpace(out)) > 0, nil
 }
 
 // Add perform a git add
@@ -154,11 +368,67 @@ func (g *Git) Add(files ...string) error {
 	return nil
 }
 
-// Commit perform a git commit
+// Commit perform a git commit. If no committer identity is configured then the author is used as the committer. If
+// signing is enabled the commit is signed. Returns ErrNothingToCommit if there are no staged changes.
 func (g *Git) Commit(message string, author string) error {
-	_, err := g.exec("commit", "-m", message, "--author", author)
+	args := append(g.signing.commitArgs(), "-m", message, "--author", author)
+	_, err := g.execEnv(g.committerEnv(author), "commit", args...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitPaths perform a git commit of only the given paths, leaving any other staged changes uncommitted. Paths are
+// relative to the root of the repo.
+func (g *Git) CommitPaths(message string, author string, paths ...string) error {
+	args := append(g.signing.commitArgs(), "-m", message, "--author", author, "--")
+	args = append(args, paths...)
+	_, err := g.execEnv(g.committerEnv(author), "commit", args...)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+var authorPattern = regexp.MustCompile(`^(.*) <(.*)>$`)
+
+// identityEnv get the environment to use the author as both the author and committer if no identity is configured
+func (g *Git) identityEnv(author string) []string {
+	env := g.committerEnv(author)
+	match := authorPattern.FindStringSubmatch(author)
+	if len(env) == 0 || match == nil {
+		return env
+	}
+	return append(env, "GIT_AUTHOR_NAME="+match[1], "GIT_AUTHOR_EMAIL="+match[2])
+}
+
+func (g *Git) committerEnv(author string) []string {
+	if _, err := g.exec("config", "--get", "user.email"); err == nil {
+		return nil
+	}
+	if os.Getenv("GIT_COMMITTER_EMAIL") != "" {
+		return nil
+	}
+	match := authorPattern.FindStringSubmatch(author)
+	if match == nil {
+		return nil
+	}
+	log.Debug("no committer identity configured, using author '%s'", author)
+	return []string{"GIT_COMMITTER_NAME=" + match[1], "GIT_COMMITTER_EMAIL=" + match[2]}
+}
+
+// HeadCommit get the hash of the current commit
+func (g *Git) HeadCommit() (*string, error) {
+	out, err := g.exec("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	hash := strings.TrimSpace(string(out))
+	return &hash, nil
+}
+
+// ShowFile get the contents of the file at the given revision. The file path is relative to the root of the repo.
+func (g *Git) ShowFile(revision, filePath string) ([]byte, error) {
+	return g.exec("show", revision+":"+strings.TrimPrefix(filePath, "/"))
+}
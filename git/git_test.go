@@ -0,0 +1,176 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+)
+
+func newTestGit(t *testing.T, dir string) *Git {
+	t.Helper()
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git binary not found")
+	}
+	g, err := New(gitPath, dir)
+	if err != nil {
+		t.Fatalf("Error opening git: %s", err.Error())
+	}
+	return g
+}
+
+// forEachBackend run the test against a new repository in an empty directory for both the git binary and the native
+// implementation
+func forEachBackend(t *testing.T, test func(t *testing.T, dir string, repo Repository)) {
+	backends := map[string]func(t *testing.T, dir string) Repository{
+		"git":    func(t *testing.T, dir string) Repository { return newTestGit(t, dir) },
+		"native": func(t *testing.T, dir string) Repository { return NewNative(dir) },
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			repo := open(t, dir)
+			if err := repo.InitIfNeeded(); err != nil {
+				t.Fatalf("Error initializing repo: %s", err.Error())
+			}
+			test(t, dir, repo)
+		})
+	}
+}
+
+func TestGitErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	g := newTestGit(t, dir)
+
+	_, err := g.HasChanges()
+	if !errors.Is(err, ErrNotRepository) {
+		t.Fatalf("Expected not a repository but got %v", err)
+	}
+	gitErr := &Error{}
+	if !errors.As(err, &gitErr) || gitErr.ExitCode != 128 || gitErr.Args[0] != "status" || gitErr.Stderr == "" {
+		t.Errorf("Unexpected error details: %+v", gitErr)
+	}
+	// Errors are not mistaken for missing branches
+	if _, err := g.BranchExists("host1"); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Expected not a repository checking for a branch but got %v", err)
+	}
+	if err := g.Checkout("host2", CheckoutOptions{Base: "host1"}); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Expected not a repository checking out a branch but got %v", err)
+	}
+
+	if err := g.InitIfNeeded(); err != nil {
+		t.Fatalf("Error initializing repo: %s", err.Error())
+	}
+	if exists, err := g.BranchExists("missing"); err != nil || exists {
+		t.Errorf("Unexpected result checking for a missing branch: %v %v", exists, err)
+	}
+	if url, err := g.RemoteURL("origin"); err != nil || url != "" {
+		t.Errorf("Unexpected result getting a missing remote: %s %v", url, err)
+	}
+	if err := g.Commit("Empty", testAuthor); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("Expected nothing to commit but got %v", err)
+	}
+	if _, err := g.ShowFile("HEAD", "missing"); err == nil || errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("Unexpected error reading a missing file: %v", err)
+	}
+}
+
+func TestGitRemoteErrors(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+	remoteDir := path.Join(tmp, "remote.git")
+	runGit(t, tmp, "init", "--bare", remoteDir)
+	localDir := path.Join(tmp, "local")
+	otherDir := path.Join(tmp, "other")
+	runGit(t, tmp, "init", "--initial-branch", "host1", localDir)
+	runGit(t, localDir, "remote", "add", "origin", remoteDir)
+	os.WriteFile(path.Join(localDir, "hosts"), []byte("one\n"), 0644)
+	runGit(t, localDir, "add", "-A")
+	runGit(t, localDir, "commit", "-m", "One")
+	runGit(t, localDir, "push", "origin", "host1")
+	runGit(t, tmp, "clone", "--branch", "host1", remoteDir, otherDir)
+	os.WriteFile(path.Join(otherDir, "hosts"), []byte("remote\n"), 0644)
+	runGit(t, otherDir, "commit", "-am", "Remote")
+	runGit(t, otherDir, "push", "origin", "host1")
+
+	g := newTestGit(t, localDir)
+	os.WriteFile(path.Join(localDir, "hosts"), []byte("local\n"), 0644)
+	if err := g.Add(localDir); err != nil {
+		t.Fatalf("Error adding files: %s", err.Error())
+	}
+	if err := g.Commit("Local", testAuthor); err != nil {
+		t.Fatalf("Error committing: %s", err.Error())
+	}
+	if err := g.Push("origin", "host1"); !errors.Is(err, ErrNonFastForward) {
+		t.Errorf("Expected non-fast-forward but got %v", err)
+	}
+	if err := g.Fetch("origin"); err != nil {
+		t.Fatalf("Error fetching: %s", err.Error())
+	}
+	if err := g.Rebase("origin/host1", testAuthor); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("Expected merge conflict but got %v", err)
+	}
+	if changed, err := g.HasChanges(); err != nil || changed {
+		t.Errorf("Expected the rebase to be aborted: %v %v", changed, err)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	t.Parallel()
+
+	for stderr, kind := range map[string]error{
+		"fatal: not a git repository (or any of the parent directories): .git":                           ErrNotRepository,
+		"git@example.com: Permission denied (publickey).\nfatal: Could not read from remote repository.": ErrAuthentication,
+		"fatal: Authentication failed for 'https://example.com/repo.git/'":                               ErrAuthentication,
+		" ! [rejected]        host1 -> host1 (fetch first)":                                              ErrNonFastForward,
+		"error: could not apply 1234567... Local":                                                        ErrMergeConflict,
+	} {
+		err := newError([]string{"test"}, nil, []byte(stderr), nil)
+		if !errors.Is(err, kind) {
+			t.Errorf("Expected '%s' to be %v", stderr, kind)
+		}
+	}
+	if err := newError([]string{"test"}, nil, []byte("fatal: something else"), nil); errors.Is(err, ErrNotRepository) {
+		t.Errorf("Unexpected error kind")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	t.Parallel()
+
+	for out, expected := range map[string]versionT{
+		"git version 2.10.0":                 {2, 10, 0},
+		"git version 2.1.0":                  {2, 1, 0},
+		"git version 1.7.9.5":                {1, 7, 9},
+		"git version 2.39.2 (Apple Git-143)": {2, 39, 2},
+		"git version 2.45.0.windows.1":       {2, 45, 0},
+		"git version 3.0":                    {3, 0, 0},
+	} {
+		version, err := parseVersion(out)
+		if err != nil {
+			t.Errorf("Error parsing version '%s': %s", out, err.Error())
+		} else if version != expected {
+			t.Errorf("Unexpected version for '%s': %s", out, version)
+		}
+	}
+	if _, err := parseVersion("git version unknown"); err == nil {
+		t.Errorf("Expected an error parsing an unknown version")
+	}
+
+	if !(versionT{2, 1, 0}).less(versionT{2, 10, 0}) {
+		t.Errorf("Expected 2.1.0 to be older than 2.10.0")
+	}
+	if !(versionT{1, 7, 9}).less(minimumGitVersion) {
+		t.Errorf("Expected 1.7.9 to be older than the minimum version")
+	}
+	if (versionT{1, 7, 10}).less(minimumGitVersion) || (versionT{1, 8, 0}).less(minimumGitVersion) {
+		t.Errorf("Expected 1.7.10 and 1.8.0 to be supported")
+	}
+}
@@ -0,0 +1,211 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"syscall"
+	"time"
+)
+
+var indexSignature = []byte("DIRC")
+
+// indexEntryT describes a single file in the index
+type indexEntryT struct {
+	CTimeSeconds     uint32
+	CTimeNanoseconds uint32
+	MTimeSeconds     uint32
+	MTimeNanoseconds uint32
+	Dev              uint32
+	Ino              uint32
+	Mode             uint32
+	UID              uint32
+	GID              uint32
+	Size             uint32
+	Hash             string
+	Stage            int
+	Path             string
+}
+
+// newIndexEntry create an index entry for the file with the given contents hash
+func newIndexEntry(filePath string, info fs.FileInfo, hash string) indexEntryT {
+	entry := indexEntryT{
+		MTimeSeconds:     uint32(info.ModTime().Unix()),
+		MTimeNanoseconds: uint32(info.ModTime().Nanosecond()),
+		Mode:             fileMode(info),
+		Size:             uint32(info.Size()),
+		Hash:             hash,
+		Path:             filePath,
+	}
+	entry.CTimeSeconds = entry.MTimeSeconds
+	entry.CTimeNanoseconds = entry.MTimeNanoseconds
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		entry.Dev = uint32(stat.Dev)
+		entry.Ino = uint32(stat.Ino)
+		entry.UID = stat.Uid
+		entry.GID = stat.Gid
+	}
+	return entry
+}
+
+// statMatches does the file appear unchanged since the entry was made. Entries modified at or after the time the index
+// was written can't be trusted, as the file may have changed again without changing its modification time.
+func (e indexEntryT) statMatches(info fs.FileInfo, indexTime time.Time) bool {
+	if !time.Unix(int64(e.MTimeSeconds), int64(e.MTimeNanoseconds)).Before(indexTime) {
+		return false
+	}
+	return e.Mode == fileMode(info) &&
+		e.Size == uint32(info.Size()) &&
+		e.MTimeSeconds == uint32(info.ModTime().Unix()) &&
+		e.MTimeNanoseconds == uint32(info.ModTime().Nanosecond())
+}
+
+// fileMode get the git mode of the file
+func fileMode(info fs.FileInfo) uint32 {
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return modeSymlink
+	}
+	if info.Mode().Perm()&0111 != 0 {
+		return modeExecutable
+	}
+	return modeFile
+}
+
+// parseIndex parse a version 2, 3 or 4 index file. Optional extensions are ignored, an error is returned for
+// extensions that are required to read the index, such as a split index.
+func parseIndex(data []byte) ([]indexEntryT, error) {
+	if len(data) < 12+20 || !bytes.Equal(data[:4], indexSignature) {
+		return nil, fmt.Errorf("invalid index file")
+	}
+	checksum := sha1.Sum(data[:len(data)-20])
+	if !bytes.Equal(checksum[:], data[len(data)-20:]) {
+		return nil, fmt.Errorf("index file checksum mismatch")
+	}
+	version := binary.BigEndian.Uint32(data[4:])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	data = data[:len(data)-20]
+
+	entries := make([]indexEntryT, 0, count)
+	offset := 12
+	previousPath := ""
+	for i := 0; i < count; i++ {
+		if len(data) < offset+62 {
+			return nil, fmt.Errorf("truncated index file")
+		}
+		fields := make([]uint32, 10)
+		for f := range fields {
+			fields[f] = binary.BigEndian.Uint32(data[offset+f*4:])
+		}
+		flags := binary.BigEndian.Uint16(data[offset+60:])
+		nameOffset := offset + 62
+		if flags&0x4000 != 0 {
+			if version < 3 {
+				return nil, fmt.Errorf("invalid index entry flags")
+			}
+			nameOffset += 2
+		}
+		// Version 4 paths only store what changed from the previous path, and are not padded
+		prefix := ""
+		if version == 4 {
+			strip, n := readIndexVarint(data[min(nameOffset, len(data)):])
+			if n == 0 || strip > len(previousPath) {
+				return nil, fmt.Errorf("invalid index entry path")
+			}
+			prefix = previousPath[:len(previousPath)-strip]
+			nameOffset += n
+		}
+		if len(data) < nameOffset {
+			return nil, fmt.Errorf("truncated index file")
+		}
+		nameEnd := bytes.IndexByte(data[nameOffset:], 0)
+		if nameEnd < 0 {
+			return nil, fmt.Errorf("truncated index file")
+		}
+		entry := indexEntryT{
+			CTimeSeconds:     fields[0],
+			CTimeNanoseconds: fields[1],
+			MTimeSeconds:     fields[2],
+			MTimeNanoseconds: fields[3],
+			Dev:              fields[4],
+			Ino:              fields[5],
+			Mode:             fields[6],
+			UID:              fields[7],
+			GID:              fields[8],
+			Size:             fields[9],
+			Hash:             hex.EncodeToString(data[offset+40 : offset+60]),
+			Stage:            int(flags>>12) & 3,
+			Path:             prefix + string(data[nameOffset:nameOffset+nameEnd]),
+		}
+		entries = append(entries, entry)
+		previousPath = entry.Path
+		if version == 4 {
+			offset = nameOffset + nameEnd + 1
+		} else {
+			offset += (nameOffset - offset + nameEnd + 8) &^ 7
+		}
+	}
+
+	for len(data) >= offset+8 {
+		signature := data[offset : offset+4]
+		size := int(binary.BigEndian.Uint32(data[offset+4:]))
+		if signature[0] < 'A' || signature[0] > 'Z' {
+			return nil, fmt.Errorf("unsupported index extension '%s'", signature)
+		}
+		offset += 8 + size
+	}
+	return entries, nil
+}
+
+// readIndexVarint read a variable length integer from a version 4 index entry, returning the value and how many bytes
+// it used. Returns zero bytes if the integer is truncated.
+func readIndexVarint(data []byte) (int, int) {
+	value := 0
+	for i, b := range data {
+		value = value<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+		value++
+	}
+	return 0, 0
+}
+
+// encodeIndex encode the entries as a version 2 index file
+func encodeIndex(entries []indexEntryT) []byte {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path == entries[j].Path {
+			return entries[i].Stage < entries[j].Stage
+		}
+		return entries[i].Path < entries[j].Path
+	})
+
+	var buf bytes.Buffer
+	buf.Write(indexSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	binary.Write(&buf, binary.BigEndian, uint32(len(entries)))
+	for _, entry := range entries {
+		hash, _ := hex.DecodeString(entry.Hash)
+		for _, field := range []uint32{entry.CTimeSeconds, entry.CTimeNanoseconds, entry.MTimeSeconds, entry.MTimeNanoseconds, entry.Dev, entry.Ino, entry.Mode, entry.UID, entry.GID, entry.Size} {
+			binary.Write(&buf, binary.BigEndian, field)
+		}
+		buf.Write(hash)
+		nameLength := len(entry.Path)
+		if nameLength > 0xfff {
+			nameLength = 0xfff
+		}
+		binary.Write(&buf, binary.BigEndian, uint16(entry.Stage<<12|nameLength))
+		buf.WriteString(entry.Path)
+		padding := ((62 + len(entry.Path) + 8) &^ 7) - 62 - len(entry.Path)
+		buf.Write(make([]byte, padding))
+	}
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+	return buf.Bytes()
+}
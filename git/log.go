@@ -0,0 +1,50 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit describes a commit in the history of a file
+type Commit struct {
+	Hash string
+	// The author of the commit, in the form 'Name <email>'
+	Author string
+	// When the commit was made
+	Time time.Time
+	// The first line of the commit message
+	Subject string
+}
+
+// FileLog get the commits reachable from revision that changed the file, newest first. The file path is relative to
+// the root of the repo.
+func (g *Git) FileLog(revision, filePath string) ([]Commit, error) {
+	out, err := g.exec("log", "--format=%H%x00%an <%ae>%x00%ct%x00%s", revision, "--", strings.TrimPrefix(filePath, "/"))
+	if err != nil {
+		return nil, err
+	}
+	commits := []Commit{}
+	for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(string(line), "\x00")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected log output: %s", line)
+		}
+		seconds, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected log output: %s", line)
+		}
+		commits = append(commits, Commit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Time:    time.Unix(seconds, 0),
+			Subject: fields[3],
+		})
+	}
+	return commits, nil
+}
@@ -0,0 +1,57 @@
+package git
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFileLog(t *testing.T) {
+	t.Parallel()
+
+	forEachBackend(t, func(t *testing.T, dir string, repo Repository) {
+		commit := func(message string) {
+			t.Helper()
+			if err := repo.Add(dir); err != nil {
+				t.Fatalf("Error adding files: %s", err.Error())
+			}
+			if err := repo.Commit(message, testAuthor); err != nil {
+				t.Fatalf("Error committing: %s", err.Error())
+			}
+		}
+		os.MkdirAll(path.Join(dir, "etc"), 0755)
+		os.WriteFile(path.Join(dir, "etc", "hosts"), []byte("one\n"), 0644)
+		commit("One")
+		os.WriteFile(path.Join(dir, "etc", "group"), []byte("wheel\n"), 0644)
+		commit("Two")
+		os.WriteFile(path.Join(dir, "etc", "hosts"), []byte("three\n"), 0644)
+		commit("Three\n\nDetails")
+		os.Remove(path.Join(dir, "etc", "hosts"))
+		commit("Four")
+
+		commits, err := repo.FileLog("HEAD", "/etc/hosts")
+		if err != nil {
+			t.Fatalf("Error getting file log: %s", err.Error())
+		}
+		subjects := []string{}
+		for _, commit := range commits {
+			subjects = append(subjects, commit.Subject)
+			if commit.Author != testAuthor || commit.Time.IsZero() || !isHash(commit.Hash) {
+				t.Errorf("Unexpected commit: %+v", commit)
+			}
+		}
+		if len(subjects) != 3 || subjects[0] != "Four" || subjects[1] != "Three" || subjects[2] != "One" {
+			t.Errorf("Unexpected commits: %v", subjects)
+		}
+		if data, err := repo.ShowFile(commits[1].Hash, "/etc/hosts"); err != nil || string(data) != "three\n" {
+			t.Errorf("Unexpected contents: %s %v", data, err)
+		}
+
+		if commits, err := repo.FileLog("HEAD~1", "etc/group"); err != nil || len(commits) != 1 || commits[0].Subject != "Two" {
+			t.Errorf("Unexpected commits: %+v %v", commits, err)
+		}
+		if commits, err := repo.FileLog("HEAD", "etc/missing"); err != nil || len(commits) != 0 {
+			t.Errorf("Unexpected commits for missing file: %+v %v", commits, err)
+		}
+	})
+}
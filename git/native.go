@@ -0,0 +1,1245 @@
+package git
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultBranch is the branch HEAD points to in new repositories
+const defaultBranch = "master"
+
+// Native is a git repository implemented in Go that needs no git binary. Repositories in a .git directory are
+// compatible with the git binary. Remotes, signing, and .gitignore files are not supported, and the committer is
+// always the author.
+type Native struct {
+	repoDir string
+	store   storage
+	// When the index was last written
+	indexTime time.Time
+}
+
+// NewNative open the git repository with its work tree in repoDir. The repository is created by InitIfNeeded if it does
+// not exist.
+func NewNative(repoDir string) *Native {
+	return &Native{
+		repoDir: repoDir,
+		store:   &fileStorage{gitDir: findGitDir(repoDir)},
+	}
+}
+
+// NewMemory create a git repository with its work tree in repoDir that keeps all objects, references, and the index in
+// memory. Nothing is written to the .git directory.
+func NewMemory(repoDir string) *Native {
+	return &Native{
+		repoDir: repoDir,
+		store:   newMemoryStorage(),
+	}
+}
+
+// fileEntryT describes a file in a tree or the index
+type fileEntryT struct {
+	Mode uint32
+	Hash string
+}
+
+// InitIfNeeded initialize a new repo if needed
+func (n *Native) InitIfNeeded() error {
+	if n.store.initialized() {
+		return nil
+	}
+	log.Debug("initializing repository in %s", n.repoDir)
+	return n.store.initialize(defaultBranch)
+}
+
+// checkRepository check that the repository has been initialized
+func (n *Native) checkRepository() error {
+	if !n.store.initialized() {
+		return fmt.Errorf("%w: %s", ErrNotRepository, n.repoDir)
+	}
+	return nil
+}
+
+// CurrentBranch get the current branch
+func (n *Native) CurrentBranch() (*string, error) {
+	if err := n.checkRepository(); err != nil {
+		return nil, err
+	}
+	value, err := n.store.readRef("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	branch := "HEAD"
+	if ref, ok := strings.CutPrefix(value, "ref: "); ok {
+		branch = strings.TrimPrefix(ref, "refs/heads/")
+	}
+	return &branch, nil
+}
+
+// Checkout checkout a specific branch. An existing local branch is switched to, otherwise the branch is created at the
+// same branch on the remote if it exists there, or is started from the base branch. Without a base branch the new
+// branch is an orphan and any files tracked by the previous branch are removed. The index and work tree are updated to
+// match, failing if that would lose uncommitted changes or overwrite untracked files.
+func (n *Native) Checkout(branch string, options CheckoutOptions) error {
+	if err := n.checkRepository(); err != nil {
+		return err
+	}
+	current, err := n.CurrentBranch()
+	if err == nil && branch == *current {
+		return nil
+	}
+	ref := "refs/heads/" + branch
+	if err := checkRefName(ref); err != nil {
+		return err
+	}
+
+	start := ref
+	exists, err := n.BranchExists(branch)
+	if err != nil {
+		return err
+	}
+	remoteExists := false
+	if !exists && options.Remote != "" {
+		if remoteExists, err = n.RemoteBranchExists(options.Remote, branch); err != nil {
+			return err
+		}
+	}
+	if remoteExists {
+		start = "refs/remotes/" + options.Remote + "/" + branch
+	} else if !exists {
+		if start, err = options.startPoint(n); err != nil {
+			return err
+		}
+	}
+	hash := ""
+	if start != "" {
+		if hash, err = n.resolveRef(start); err != nil {
+			return err
+		}
+	}
+
+	if _, err := n.resolveRef("HEAD"); err == nil || hash != "" {
+		if err := n.checkoutFiles(hash); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, errNotFound) {
+		return err
+	}
+	if hash != "" && start != ref {
+		if err := n.store.writeRef(ref, hash); err != nil {
+			return err
+		}
+	}
+	return n.store.writeRef("HEAD", "ref: "+ref)
+}
+
+// checkoutFiles update the index and the work tree from the current commit to the commit with the given hash, or to
+// no files if hash is empty. Nothing is changed if a file that differs between the commits has uncommitted changes, or
+// if an untracked file would be overwritten.
+func (n *Native) checkoutFiles(hash string) error {
+	index, err := n.readIndex()
+	if err != nil {
+		return err
+	}
+	head, err := n.headFiles()
+	if err != nil {
+		return err
+	}
+	target := map[string]fileEntryT{}
+	if hash != "" {
+		commit, err := n.readCommit(hash)
+		if err != nil {
+			return err
+		}
+		if target, err = n.treeFiles(commit.Tree); err != nil {
+			return err
+		}
+	}
+
+	changed := map[string]bool{}
+	for filePath, file := range head {
+		if target[filePath] != file {
+			changed[filePath] = true
+		}
+	}
+	for filePath, file := range target {
+		if head[filePath] != file {
+			changed[filePath] = true
+		}
+	}
+	for _, filePath := range sortedKeys(changed) {
+		entry, tracked := index[filePath]
+		headFile, inHead := head[filePath]
+		if tracked != inHead || (tracked && (fileEntryT{Mode: entry.Mode, Hash: entry.Hash}) != headFile) {
+			return fmt.Errorf("your local changes to '%s' would be overwritten by checkout", filePath)
+		}
+		info, err := os.Lstat(n.workTreePath(filePath))
+		if os.IsNotExist(err) {
+			if tracked {
+				return fmt.Errorf("your local changes to '%s' would be overwritten by checkout", filePath)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !tracked {
+			return fmt.Errorf("untracked working tree file '%s' would be overwritten by checkout", filePath)
+		}
+		if entry.statMatches(info, n.indexTime) {
+			continue
+		}
+		fileHash, err := n.hashWorkTreeFile(filePath, info, false)
+		if err != nil {
+			return err
+		}
+		if fileHash != entry.Hash || entry.Mode != fileMode(info) {
+			return fmt.Errorf("your local changes to '%s' would be overwritten by checkout", filePath)
+		}
+	}
+
+	// Remove files first so that a removed file can be replaced by a directory of the same name
+	for _, filePath := range sortedKeys(changed) {
+		if _, ok := target[filePath]; ok {
+			continue
+		}
+		delete(index, filePath)
+		if err := os.Remove(n.workTreePath(filePath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		n.removeEmptyParents(filePath)
+	}
+	for _, filePath := range sortedKeys(changed) {
+		file, ok := target[filePath]
+		if !ok {
+			continue
+		}
+		info, err := n.writeWorkTreeFile(filePath, file)
+		if err != nil {
+			return err
+		}
+		index[filePath] = newIndexEntry(filePath, info, file.Hash)
+	}
+	return n.writeIndex(index)
+}
+
+// writeWorkTreeFile write the blob to the work tree with the file mode, replacing any existing file
+func (n *Native) writeWorkTreeFile(filePath string, file fileEntryT) (fs.FileInfo, error) {
+	objectType, data, err := n.store.readObject(file.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != objectBlob {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", file.Hash, objectType)
+	}
+	destPath := n.workTreePath(filePath)
+	if err := os.MkdirAll(path.Dir(destPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	switch file.Mode {
+	case modeSymlink:
+		err = os.Symlink(string(data), destPath)
+	case modeExecutable:
+		err = os.WriteFile(destPath, data, 0755)
+	default:
+		err = os.WriteFile(destPath, data, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(destPath)
+}
+
+// BranchExists does the local branch exist
+func (n *Native) BranchExists(branch string) (bool, error) {
+	return n.refExists("refs/heads/" + branch)
+}
+
+// RemoteBranchExists does the remote-tracking branch exist
+func (n *Native) RemoteBranchExists(remote, branch string) (bool, error) {
+	return n.refExists("refs/remotes/" + remote + "/" + branch)
+}
+
+// refExists does the reference exist
+func (n *Native) refExists(ref string) (bool, error) {
+	if err := n.checkRepository(); err != nil {
+		return false, err
+	}
+	_, err := n.resolveRef(ref)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RemoteURL is not supported
+func (n *Native) RemoteURL(remote string) (string, error) {
+	return "", fmt.Errorf("%w: remotes", ErrUnsupported)
+}
+
+// SetRemote is not supported
+func (n *Native) SetRemote(remote, url string) error {
+	return fmt.Errorf("%w: remotes", ErrUnsupported)
+}
+
+// Fetch is not supported
+func (n *Native) Fetch(remote string) error {
+	return fmt.Errorf("%w: fetch", ErrUnsupported)
+}
+
+// Rebase is not supported
+func (n *Native) Rebase(upstream, author string) error {
+	return fmt.Errorf("%w: rebase", ErrUnsupported)
+}
+
+// Merge is not supported
+func (n *Native) Merge(upstream, author string) error {
+	return fmt.Errorf("%w: merge", ErrUnsupported)
+}
+
+// Push is not supported
+func (n *Native) Push(remote, local string) error {
+	return fmt.Errorf("%w: push", ErrUnsupported)
+}
+
+// PushTags is not supported
+func (n *Native) PushTags(remote string, tags ...string) error {
+	return fmt.Errorf("%w: push", ErrUnsupported)
+}
+
+// CreateTag create an annotated tag at revision. The author is used as the tagger. Returns ErrTagExists if a tag with
+// the name already exists.
+func (n *Native) CreateTag(name, revision, message, author string) error {
+	if err := n.checkRepository(); err != nil {
+		return err
+	}
+	ref := "refs/tags/" + name
+	if err := checkRefName(ref); err != nil {
+		return err
+	}
+	if _, err := n.resolveRef(ref); err == nil {
+		return fmt.Errorf("%w: %s", ErrTagExists, name)
+	} else if !errors.Is(err, errNotFound) {
+		return err
+	}
+	hash, err := n.resolveRevision(revision)
+	if err != nil {
+		return err
+	}
+	identity, err := signature(author, time.Now())
+	if err != nil {
+		return err
+	}
+	tagHash, err := n.store.writeObject(objectTag, encodeTag(tagT{
+		Object:  hash,
+		Type:    objectCommit,
+		Name:    name,
+		Tagger:  identity,
+		Message: strings.TrimSpace(message) + "\n",
+	}))
+	if err != nil {
+		return err
+	}
+	log.Debug("created tag %s", tagHash)
+	return n.store.writeRef(ref, tagHash)
+}
+
+// Tags get all tags, sorted by name
+func (n *Native) Tags() ([]Tag, error) {
+	if err := n.checkRepository(); err != nil {
+		return nil, err
+	}
+	refs, err := n.store.listRefs("refs/tags/")
+	if err != nil {
+		return nil, err
+	}
+	tags := []Tag{}
+	for _, ref := range refs {
+		hash, err := n.resolveRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		tag := Tag{Name: strings.TrimPrefix(ref, "refs/tags/")}
+		objectType, data, err := n.store.readObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		if objectType == objectTag {
+			annotated, err := parseTag(data)
+			if err != nil {
+				return nil, err
+			}
+			tag.Subject = subject(annotated.Message)
+			tag.Time = annotated.Time()
+		}
+		if tag.Commit, err = n.peelCommit(hash); err != nil {
+			return nil, err
+		}
+		if objectType != objectTag {
+			commit, err := n.readCommit(tag.Commit)
+			if err != nil {
+				return nil, err
+			}
+			tag.Subject = subject(commit.Message)
+			tag.Time = commit.Time()
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// errChanged stops walking the work tree once a change is found
+var errChanged = errors.New("changed")
+
+// HasChanges does the repo have any staged, unstaged, or untracked files
+func (n *Native) HasChanges() (bool, error) {
+	if err := n.checkRepository(); err != nil {
+		return false, err
+	}
+	index, err := n.readIndex()
+	if err != nil {
+		return false, err
+	}
+
+	indexTree, err := n.writeTree(indexFiles(index), false)
+	if err != nil {
+		return false, err
+	}
+	headTree, err := n.headTree()
+	if err != nil {
+		return false, err
+	}
+	if (headTree == "" && len(index) > 0) || (headTree != "" && headTree != indexTree) {
+		return true, nil
+	}
+
+	seen := 0
+	err = n.walkWorkTree("", func(filePath string, info fs.FileInfo) error {
+		entry, ok := index[filePath]
+		if !ok {
+			return errChanged
+		}
+		seen++
+		if entry.statMatches(info, n.indexTime) {
+			return nil
+		}
+		hash, err := n.hashWorkTreeFile(filePath, info, false)
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash || entry.Mode != fileMode(info) {
+			return errChanged
+		}
+		return nil
+	})
+	if errors.Is(err, errChanged) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return seen != len(index), nil
+}
+
+// Add stage the files, or all files in the directories, including removed files
+func (n *Native) Add(files ...string) error {
+	if err := n.checkRepository(); err != nil {
+		return err
+	}
+	index, err := n.readIndex()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		filePath, err := n.relativePath(file)
+		if err != nil {
+			return err
+		}
+		matched, err := n.stage(index, filePath)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			return fmt.Errorf("pathspec '%s' did not match any files", file)
+		}
+	}
+	return n.writeIndex(index)
+}
+
+// stage update the index to match the work tree for every file at or below filePath. Returns false if no file matched.
+func (n *Native) stage(index map[string]indexEntryT, filePath string) (bool, error) {
+	matched := false
+	for indexPath := range index {
+		if !underPath(indexPath, filePath) {
+			continue
+		}
+		matched = true
+		if info, err := os.Lstat(n.workTreePath(indexPath)); err != nil || info.IsDir() {
+			delete(index, indexPath)
+		}
+	}
+
+	err := n.walkWorkTree(filePath, func(entryPath string, info fs.FileInfo) error {
+		matched = true
+		if entry, ok := index[entryPath]; ok && entry.statMatches(info, n.indexTime) {
+			return nil
+		}
+		hash, err := n.hashWorkTreeFile(entryPath, info, true)
+		if err != nil {
+			return err
+		}
+		index[entryPath] = newIndexEntry(entryPath, info, hash)
+		return nil
+	})
+	return matched, err
+}
+
+// Remove remove the files from the index and the work tree. Files that are not tracked are still removed from the
+// work tree.
+func (n *Native) Remove(filePath ...string) error {
+	if err := n.checkRepository(); err != nil {
+		return err
+	}
+	index, err := n.readIndex()
+	if err != nil {
+		return err
+	}
+	for _, file := range filePath {
+		indexPath, err := n.relativePath(file)
+		if err != nil {
+			return err
+		}
+		delete(index, indexPath)
+		if err := os.Remove(n.workTreePath(indexPath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		n.removeEmptyParents(indexPath)
+	}
+	return n.writeIndex(index)
+}
+
+// removeEmptyParents remove the directories containing filePath that are now empty, like git does
+func (n *Native) removeEmptyParents(filePath string) {
+	for dir := path.Dir(filePath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if err := os.Remove(n.workTreePath(dir)); err != nil {
+			return
+		}
+	}
+}
+
+// Commit commit all staged changes. The author is used as the committer.
+func (n *Native) Commit(message string, author string) error {
+	if err := n.checkRepository(); err != nil {
+		return err
+	}
+	index, err := n.readIndex()
+	if err != nil {
+		return err
+	}
+	return n.commitFiles(message, author, indexFiles(index))
+}
+
+// CommitPaths commit only the given paths, leaving any other staged changes uncommitted. Paths are relative to the root
+// of the repo.
+func (n *Native) CommitPaths(message string, author string, paths ...string) error {
+	if err := n.checkRepository(); err != nil {
+		return err
+	}
+	index, err := n.readIndex()
+	if err != nil {
+		return err
+	}
+	files, err := n.headFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range paths {
+		filePath, err := n.relativePath(file)
+		if err != nil {
+			return err
+		}
+		matched, err := n.stage(index, filePath)
+		if err != nil {
+			return err
+		}
+		for headPath := range files {
+			if underPath(headPath, filePath) {
+				matched = true
+				delete(files, headPath)
+			}
+		}
+		if !matched {
+			return fmt.Errorf("pathspec '%s' did not match any files known to git", file)
+		}
+		for indexPath, entry := range index {
+			if underPath(indexPath, filePath) {
+				files[indexPath] = fileEntryT{Mode: entry.Mode, Hash: entry.Hash}
+			}
+		}
+	}
+
+	if err := n.commitFiles(message, author, files); err != nil {
+		return err
+	}
+	return n.writeIndex(index)
+}
+
+func (n *Native) commitFiles(message string, author string, files map[string]fileEntryT) error {
+	tree, err := n.writeTree(files, true)
+	if err != nil {
+		return err
+	}
+
+	commit := commitT{Tree: tree}
+	parent, err := n.resolveRef("HEAD")
+	if err == nil {
+		parentCommit, err := n.readCommit(parent)
+		if err != nil {
+			return err
+		}
+		if parentCommit.Tree == tree {
+			return ErrNothingToCommit
+		}
+		commit.Parents = []string{parent}
+	} else if !errors.Is(err, errNotFound) {
+		return err
+	} else if len(files) == 0 {
+		return ErrNothingToCommit
+	}
+
+	identity, err := signature(author, time.Now())
+	if err != nil {
+		return err
+	}
+	commit.Author = identity
+	commit.Committer = identity
+	commit.Message = strings.TrimSpace(message) + "\n"
+	hash, err := n.store.writeObject(objectCommit, encodeCommit(commit))
+	if err != nil {
+		return err
+	}
+	log.Debug("created commit %s", hash)
+	return n.updateHead(hash)
+}
+
+// updateHead point the current branch, or HEAD if it is detached, at the commit
+func (n *Native) updateHead(hash string) error {
+	value, err := n.store.readRef("HEAD")
+	if err != nil {
+		return err
+	}
+	if ref, ok := strings.CutPrefix(value, "ref: "); ok {
+		return n.store.writeRef(ref, hash)
+	}
+	return n.store.writeRef("HEAD", hash)
+}
+
+// HeadCommit get the hash of the current commit
+func (n *Native) HeadCommit() (*string, error) {
+	if err := n.checkRepository(); err != nil {
+		return nil, err
+	}
+	hash, err := n.resolveRef("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return &hash, nil
+}
+
+// ShowFile get the contents of the file at the given revision. The file path is relative to the root of the repo.
+func (n *Native) ShowFile(revision, filePath string) ([]byte, error) {
+	if err := n.checkRepository(); err != nil {
+		return nil, err
+	}
+	hash, err := n.resolveRevision(revision)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := n.readCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := n.treeEntry(commit.Tree, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("path '%s' does not exist in '%s'", filePath, revision)
+	}
+	if entry.isTree() {
+		return nil, fmt.Errorf("path '%s' is a directory in '%s'", filePath, revision)
+	}
+	_, data, err := n.store.readObject(entry.Hash)
+	return data, err
+}
+
+// treeEntry find the entry for the path, relative to the root of the tree. Returns nil if the path does not exist.
+func (n *Native) treeEntry(tree, filePath string) (*treeEntryT, error) {
+	entry := treeEntryT{Mode: modeTree, Hash: tree}
+	for _, name := range strings.Split(strings.Trim(filePath, "/"), "/") {
+		if !entry.isTree() {
+			return nil, nil
+		}
+		entries, err := n.readTree(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, child := range entries {
+			if child.Name == name {
+				entry = child
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+	return &entry, nil
+}
+
+// FileLog get the commits reachable from revision that changed the file, newest first. The file path is relative to
+// the root of the repo. Merges are only included if the file differs from every parent.
+func (n *Native) FileLog(revision, filePath string) ([]Commit, error) {
+	if err := n.checkRepository(); err != nil {
+		return nil, err
+	}
+	hash, err := n.resolveRevision(revision)
+	if err != nil {
+		return nil, err
+	}
+	commits := []Commit{}
+	var walkErr error
+	err = n.walkHistory(hash, func(hash string) bool {
+		commit, err := n.readCommit(hash)
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		changed, err := n.changesFile(commit, filePath)
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		if changed {
+			commits = append(commits, Commit{
+				Hash:    hash,
+				Author:  commit.author(),
+				Time:    commit.Time(),
+				Subject: subject(commit.Message),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, walkErr
+}
+
+// changesFile does the file in the commit differ from the file in every parent of the commit
+func (n *Native) changesFile(commit *commitT, filePath string) (bool, error) {
+	entry, err := n.treeEntry(commit.Tree, filePath)
+	if err != nil {
+		return false, err
+	}
+	for _, parent := range commit.Parents {
+		parentCommit, err := n.readCommit(parent)
+		if err != nil {
+			return false, err
+		}
+		parentEntry, err := n.treeEntry(parentCommit.Tree, filePath)
+		if err != nil {
+			return false, err
+		}
+		if (entry == nil && parentEntry == nil) || (entry != nil && parentEntry != nil && *entry == *parentEntry) {
+			return false, nil
+		}
+	}
+	return len(commit.Parents) > 0 || entry != nil, nil
+}
+
+// RevList get the hashes of the last count commits reachable from revision, oldest first
+func (n *Native) RevList(revision string, count int) ([]string, error) {
+	if err := n.checkRepository(); err != nil {
+		return nil, err
+	}
+	hash, err := n.resolveRevision(revision)
+	if err != nil {
+		return nil, err
+	}
+	commits := []string{}
+	err = n.walkHistory(hash, func(hash string) bool {
+		commits = append(commits, hash)
+		return len(commits) < count
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// Divergence count the commits on local that are not on upstream (ahead) and on upstream that are not on local (behind)
+func (n *Native) Divergence(local, upstream string) (int, int, error) {
+	if err := n.checkRepository(); err != nil {
+		return 0, 0, err
+	}
+	reachable := func(revision string) (map[string]bool, error) {
+		hash, err := n.resolveRevision(revision)
+		if err != nil {
+			return nil, err
+		}
+		commits := map[string]bool{}
+		err = n.walkHistory(hash, func(hash string) bool {
+			commits[hash] = true
+			return true
+		})
+		return commits, err
+	}
+	localCommits, err := reachable(local)
+	if err != nil {
+		return 0, 0, err
+	}
+	upstreamCommits, err := reachable(upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind := 0, 0
+	for hash := range localCommits {
+		if !upstreamCommits[hash] {
+			ahead++
+		}
+	}
+	for hash := range upstreamCommits {
+		if !localCommits[hash] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// commitQueueT orders commits newest first
+type commitQueueT []commitQueueItemT
+
+type commitQueueItemT struct {
+	Hash string
+	Time time.Time
+}
+
+func (q commitQueueT) Len() int           { return len(q) }
+func (q commitQueueT) Less(i, j int) bool { return q[i].Time.After(q[j].Time) }
+func (q commitQueueT) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *commitQueueT) Push(x any)        { *q = append(*q, x.(commitQueueItemT)) }
+func (q *commitQueueT) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// walkHistory call fn for the commit and each of its ancestors, newest first, until fn returns false
+func (n *Native) walkHistory(hash string, fn func(hash string) bool) error {
+	seen := map[string]bool{hash: true}
+	queue := &commitQueueT{}
+	commit, err := n.readCommit(hash)
+	if err != nil {
+		return err
+	}
+	heap.Push(queue, commitQueueItemT{Hash: hash, Time: commit.Time()})
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(commitQueueItemT)
+		if !fn(item.Hash) {
+			return nil
+		}
+		commit, err := n.readCommit(item.Hash)
+		if err != nil {
+			return err
+		}
+		for _, parent := range commit.Parents {
+			if seen[parent] {
+				continue
+			}
+			seen[parent] = true
+			parentCommit, err := n.readCommit(parent)
+			if err != nil {
+				return err
+			}
+			heap.Push(queue, commitQueueItemT{Hash: parent, Time: parentCommit.Time()})
+		}
+	}
+	return nil
+}
+
+// resolveRef get the commit hash the reference points to, following symbolic references
+func (n *Native) resolveRef(name string) (string, error) {
+	for depth := 0; depth < 5; depth++ {
+		value, err := n.store.readRef(name)
+		if err != nil {
+			return "", err
+		}
+		ref, ok := strings.CutPrefix(value, "ref: ")
+		if !ok {
+			if !isHash(value) {
+				return "", fmt.Errorf("invalid reference '%s'", name)
+			}
+			return value, nil
+		}
+		name = ref
+	}
+	return "", fmt.Errorf("too many levels of symbolic references")
+}
+
+// resolveRevision get the hash of the commit for a revision. Hashes, abbreviated hashes, references, and the '~' and '^'
+// suffixes are supported.
+func (n *Native) resolveRevision(revision string) (string, error) {
+	name := revision
+	suffix := ""
+	if i := strings.IndexAny(revision, "~^"); i >= 0 {
+		name = revision[:i]
+		suffix = revision[i:]
+	}
+	hash, err := n.resolveName(name)
+	if err != nil {
+		return "", err
+	}
+	hash, err = n.peelCommit(hash)
+	if err != nil {
+		return "", err
+	}
+
+	for suffix != "" {
+		operator := suffix[0]
+		suffix = suffix[1:]
+		digits := len(suffix) - len(strings.TrimLeft(suffix, "0123456789"))
+		number := 1
+		if digits > 0 {
+			number, _ = strconv.Atoi(suffix[:digits])
+			suffix = suffix[digits:]
+		}
+		generations, parent := number, 1
+		if operator == '^' {
+			generations, parent = 1, number
+		}
+		for i := 0; i < generations && parent > 0; i++ {
+			commit, err := n.readCommit(hash)
+			if err != nil {
+				return "", err
+			}
+			if len(commit.Parents) < parent {
+				return "", fmt.Errorf("unknown revision '%s'", revision)
+			}
+			hash = commit.Parents[parent-1]
+		}
+	}
+	return hash, nil
+}
+
+func (n *Native) resolveName(name string) (string, error) {
+	if name == "" || name == "@" {
+		name = "HEAD"
+	}
+	if isHash(name) {
+		return name, nil
+	}
+	if !strings.Contains(name, "..") {
+		for _, ref := range []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"} {
+			hash, err := n.resolveRef(ref)
+			if err == nil {
+				return hash, nil
+			}
+			if !errors.Is(err, errNotFound) {
+				return "", err
+			}
+		}
+	}
+	if len(name) >= 4 && isHex(name) {
+		hashes, err := n.store.findObjects(name)
+		if err != nil {
+			return "", err
+		}
+		if len(hashes) == 1 {
+			return hashes[0], nil
+		}
+		if len(hashes) > 1 {
+			return "", fmt.Errorf("short object ID '%s' is ambiguous", name)
+		}
+	}
+	return "", fmt.Errorf("unknown revision '%s'", name)
+}
+
+// peelCommit follow annotated tags to the commit they point to
+func (n *Native) peelCommit(hash string) (string, error) {
+	for depth := 0; depth < 10; depth++ {
+		objectType, data, err := n.store.readObject(hash)
+		if err != nil {
+			return "", err
+		}
+		switch objectType {
+		case objectCommit:
+			return hash, nil
+		case objectTag:
+			tag, err := parseTag(data)
+			if err != nil {
+				return "", err
+			}
+			hash = tag.Object
+		default:
+			return "", fmt.Errorf("object %s is a %s, not a commit", hash, objectType)
+		}
+	}
+	return "", fmt.Errorf("too many levels of tags")
+}
+
+func (n *Native) readCommit(hash string) (*commitT, error) {
+	objectType, data, err := n.store.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != objectCommit {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, objectType)
+	}
+	return parseCommit(data)
+}
+
+func (n *Native) readTree(hash string) ([]treeEntryT, error) {
+	objectType, data, err := n.store.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != objectTree {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", hash, objectType)
+	}
+	return parseTree(data)
+}
+
+// headTree get the hash of the tree of the current commit, or an empty string if there are no commits
+func (n *Native) headTree() (string, error) {
+	hash, err := n.resolveRef("HEAD")
+	if errors.Is(err, errNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	commit, err := n.readCommit(hash)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
+
+// headFiles get every file in the current commit, keyed by path
+func (n *Native) headFiles() (map[string]fileEntryT, error) {
+	tree, err := n.headTree()
+	if err != nil || tree == "" {
+		return map[string]fileEntryT{}, err
+	}
+	return n.treeFiles(tree)
+}
+
+// treeFiles get every file in the tree and its subtrees, keyed by path
+func (n *Native) treeFiles(tree string) (map[string]fileEntryT, error) {
+	files := map[string]fileEntryT{}
+	var walk func(hash, prefix string) error
+	walk = func(hash, prefix string) error {
+		entries, err := n.readTree(hash)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.isTree() {
+				if err := walk(entry.Hash, prefix+entry.Name+"/"); err != nil {
+					return err
+				}
+				continue
+			}
+			files[prefix+entry.Name] = fileEntryT{Mode: entry.Mode, Hash: entry.Hash}
+		}
+		return nil
+	}
+	return files, walk(tree, "")
+}
+
+// writeTree write the tree objects for the files and return the hash of the root tree. If store is false the hash is
+// calculated without writing anything.
+func (n *Native) writeTree(files map[string]fileEntryT, store bool) (string, error) {
+	type dirT struct {
+		files map[string]fileEntryT
+		dirs  map[string]*dirT
+	}
+	newDir := func() *dirT {
+		return &dirT{files: map[string]fileEntryT{}, dirs: map[string]*dirT{}}
+	}
+	root := newDir()
+	for filePath, file := range files {
+		parts := strings.Split(filePath, "/")
+		dir := root
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := dir.dirs[part]
+			if !ok {
+				child = newDir()
+				dir.dirs[part] = child
+			}
+			dir = child
+		}
+		dir.files[parts[len(parts)-1]] = file
+	}
+
+	var write func(dir *dirT) (string, error)
+	write = func(dir *dirT) (string, error) {
+		entries := []treeEntryT{}
+		for name, file := range dir.files {
+			entries = append(entries, treeEntryT{Mode: file.Mode, Name: name, Hash: file.Hash})
+		}
+		for name, child := range dir.dirs {
+			hash, err := write(child)
+			if err != nil {
+				return "", err
+			}
+			entries = append(entries, treeEntryT{Mode: modeTree, Name: name, Hash: hash})
+		}
+		data := encodeTree(entries)
+		if !store {
+			return hashObject(objectTree, data), nil
+		}
+		return n.store.writeObject(objectTree, data)
+	}
+	return write(root)
+}
+
+func (n *Native) readIndex() (map[string]indexEntryT, error) {
+	index := map[string]indexEntryT{}
+	data, indexTime, err := n.store.readIndex()
+	if err != nil || data == nil {
+		return index, err
+	}
+	n.indexTime = indexTime
+	entries, err := parseIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Stage != 0 {
+			return nil, fmt.Errorf("%w: index has unmerged path '%s'", ErrMergeConflict, entry.Path)
+		}
+		index[entry.Path] = entry
+	}
+	return index, nil
+}
+
+func (n *Native) writeIndex(index map[string]indexEntryT) error {
+	entries := make([]indexEntryT, 0, len(index))
+	for _, entry := range index {
+		entries = append(entries, entry)
+	}
+	return n.store.writeIndex(encodeIndex(entries))
+}
+
+func indexFiles(index map[string]indexEntryT) map[string]fileEntryT {
+	files := map[string]fileEntryT{}
+	for filePath, entry := range index {
+		files[filePath] = fileEntryT{Mode: entry.Mode, Hash: entry.Hash}
+	}
+	return files
+}
+
+// walkWorkTree call fn for every file and symlink at or below filePath in the work tree, skipping .git directories
+func (n *Native) walkWorkTree(filePath string, fn func(filePath string, info fs.FileInfo) error) error {
+	root := n.workTreePath(filePath)
+	err := filepath.WalkDir(root, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(n.repoDir, walkPath)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// hashWorkTreeFile get the blob hash of the file in the work tree, writing the blob if store is true
+func (n *Native) hashWorkTreeFile(filePath string, info fs.FileInfo, store bool) (string, error) {
+	var data []byte
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(n.workTreePath(filePath))
+		if err != nil {
+			return "", err
+		}
+		data = []byte(target)
+	} else {
+		contents, err := os.ReadFile(n.workTreePath(filePath))
+		if err != nil {
+			return "", err
+		}
+		data = contents
+	}
+	if !store {
+		return hashObject(objectBlob, data), nil
+	}
+	return n.store.writeObject(objectBlob, data)
+}
+
+func (n *Native) workTreePath(filePath string) string {
+	return path.Join(n.repoDir, filePath)
+}
+
+// relativePath get the path relative to the root of the work tree. Absolute paths must be within the work tree.
+func (n *Native) relativePath(filePath string) (string, error) {
+	if filepath.IsAbs(filePath) {
+		repoDir, err := filepath.Abs(n.repoDir)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(repoDir, filePath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return "", fmt.Errorf("path '%s' is outside of the repository", filePath)
+		}
+		filePath = rel
+	}
+	filePath = path.Clean(filepath.ToSlash(filePath))
+	if filePath == "." {
+		return "", nil
+	}
+	if filePath == ".." || strings.HasPrefix(filePath, "../") {
+		return "", fmt.Errorf("path '%s' is outside of the repository", filePath)
+	}
+	return filePath, nil
+}
+
+// underPath is filePath the same as, or inside of, dir. An empty dir matches all paths.
+func underPath(filePath, dir string) bool {
+	return dir == "" || filePath == dir || strings.HasPrefix(filePath, dir+"/")
+}
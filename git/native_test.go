@@ -0,0 +1,274 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+const testAuthor = "configsync <configsync@example.com>"
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not found")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Error running git %v: %s %s", args, err.Error(), out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func hasChanges(t *testing.T, repo Repository) bool {
+	t.Helper()
+	changed, err := repo.HasChanges()
+	if err != nil {
+		t.Fatalf("Error getting status: %s", err.Error())
+	}
+	return changed
+}
+
+func TestNativeCompatibleWithGit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	n := NewNative(dir)
+	if err := n.InitIfNeeded(); err != nil {
+		t.Fatalf("Error initializing repo: %s", err.Error())
+	}
+	if err := n.Checkout("host1", CheckoutOptions{}); err != nil {
+		t.Fatalf("Error checking out branch: %s", err.Error())
+	}
+
+	os.MkdirAll(path.Join(dir, "etc", "ssh"), 0755)
+	os.WriteFile(path.Join(dir, "etc", "hosts"), []byte("127.0.0.1 localhost\n"), 0644)
+	os.WriteFile(path.Join(dir, "etc", "ssh", "sshd_config"), []byte("PermitRootLogin no\n"), 0644)
+	os.WriteFile(path.Join(dir, "etc", "script"), []byte("#!/bin/sh\n"), 0755)
+	os.Symlink("hosts", path.Join(dir, "etc", "hosts.link"))
+	if !hasChanges(t, n) {
+		t.Fatalf("Expected untracked files to be changes")
+	}
+	if err := n.Add(dir); err != nil {
+		t.Fatalf("Error adding files: %s", err.Error())
+	}
+	if err := n.Commit("First commit", testAuthor); err != nil {
+		t.Fatalf("Error committing: %s", err.Error())
+	}
+	if hasChanges(t, n) {
+		t.Errorf("Unexpected changes after commit")
+	}
+	if err := n.Commit("Empty commit", testAuthor); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("Expected nothing to commit but got %v", err)
+	}
+
+	runGit(t, dir, "fsck", "--strict")
+	if status := runGit(t, dir, "status", "--porcelain"); status != "" {
+		t.Errorf("Unexpected git status: %s", status)
+	}
+	if branch := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "host1" {
+		t.Errorf("Unexpected branch: %s", branch)
+	}
+	if contents := runGit(t, dir, "show", "HEAD:etc/ssh/sshd_config"); contents != "PermitRootLogin no" {
+		t.Errorf("Unexpected file contents: %s", contents)
+	}
+	if mode := runGit(t, dir, "ls-tree", "HEAD", "etc/script"); !strings.HasPrefix(mode, "100755") {
+		t.Errorf("Unexpected file mode: %s", mode)
+	}
+
+	os.WriteFile(path.Join(dir, "etc", "hosts"), []byte("127.0.0.1 localhost.localdomain\n"), 0644)
+	if err := n.Remove(path.Join(dir, "etc", "ssh", "sshd_config")); err != nil {
+		t.Fatalf("Error removing file: %s", err.Error())
+	}
+	if _, err := os.Stat(path.Join(dir, "etc", "ssh")); !os.IsNotExist(err) {
+		t.Errorf("Expected empty directory to be removed")
+	}
+	if err := n.Add(dir); err != nil {
+		t.Fatalf("Error adding files: %s", err.Error())
+	}
+	if err := n.CommitPaths("Remove sshd_config", testAuthor, "etc/ssh/sshd_config"); err != nil {
+		t.Fatalf("Error committing paths: %s", err.Error())
+	}
+	if status := runGit(t, dir, "status", "--porcelain"); status != "M  etc/hosts" {
+		t.Errorf("Expected only the committed path to be committed: %s", status)
+	}
+	if err := n.Commit("Update hosts", testAuthor); err != nil {
+		t.Fatalf("Error committing: %s", err.Error())
+	}
+
+	runGit(t, dir, "fsck", "--strict")
+	if count := runGit(t, dir, "rev-list", "--count", "HEAD"); count != "3" {
+		t.Errorf("Unexpected number of commits: %s", count)
+	}
+	head, err := n.HeadCommit()
+	if err != nil || *head != runGit(t, dir, "rev-parse", "HEAD") {
+		t.Errorf("Unexpected head commit: %v %v", head, err)
+	}
+}
+
+func TestNativeReadsGit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--initial-branch", "host1")
+	os.WriteFile(path.Join(dir, "hosts"), []byte("one\n"), 0644)
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-m", "One")
+	os.WriteFile(path.Join(dir, "hosts"), []byte("two\n"), 0644)
+	runGit(t, dir, "commit", "-am", "Two")
+	runGit(t, dir, "tag", "-a", "-m", "Before", "before", "HEAD~1")
+	runGit(t, dir, "gc", "--quiet")
+	os.WriteFile(path.Join(dir, "hosts"), []byte("three\n"), 0644)
+	runGit(t, dir, "commit", "-am", "Three")
+
+	n := NewNative(dir)
+	if hasChanges(t, n) {
+		t.Errorf("Unexpected changes in clean repo")
+	}
+	for revision, expected := range map[string]string{
+		"HEAD":     "three\n",
+		"HEAD~1":   "two\n",
+		"host1^^":  "one\n",
+		"before":   "one\n",
+		"HEAD~2^0": "one\n",
+	} {
+		data, err := n.ShowFile(revision, "/hosts")
+		if err != nil {
+			t.Errorf("Error reading file at %s: %s", revision, err.Error())
+		} else if string(data) != expected {
+			t.Errorf("Unexpected contents at %s: %s", revision, data)
+		}
+	}
+	short := runGit(t, dir, "rev-parse", "--short", "HEAD~1")
+	if data, err := n.ShowFile(short, "hosts"); err != nil || string(data) != "two\n" {
+		t.Errorf("Unexpected contents at %s: %s %v", short, data, err)
+	}
+	if _, err := n.ShowFile("HEAD", "missing"); err == nil {
+		t.Errorf("Expected an error reading a missing file")
+	}
+
+	commits, err := n.RevList("HEAD", 2)
+	if err != nil {
+		t.Fatalf("Error listing commits: %s", err.Error())
+	}
+	if strings.Join(commits, " ") != strings.ReplaceAll(runGit(t, dir, "rev-list", "--reverse", "--max-count=2", "HEAD"), "\n", " ") {
+		t.Errorf("Unexpected commits: %v", commits)
+	}
+	ahead, behind, err := n.Divergence("HEAD", "before")
+	if err != nil || ahead != 2 || behind != 0 {
+		t.Errorf("Unexpected divergence: %d %d %v", ahead, behind, err)
+	}
+
+	os.WriteFile(path.Join(dir, "group"), []byte("wheel\n"), 0644)
+	if err := n.Add("group"); err != nil {
+		t.Fatalf("Error adding file: %s", err.Error())
+	}
+	if err := n.Commit("Four", testAuthor); err != nil {
+		t.Fatalf("Error committing: %s", err.Error())
+	}
+	runGit(t, dir, "fsck", "--strict")
+	if status := runGit(t, dir, "status", "--porcelain"); status != "" {
+		t.Errorf("Unexpected git status: %s", status)
+	}
+}
+
+func TestNativeIndexFormats(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--initial-branch", "host1")
+	for _, file := range []string{"etc/group", "etc/hosts", "etc/ssh/sshd_config", "usr/local/etc/hosts"} {
+		os.MkdirAll(path.Join(dir, path.Dir(file)), 0755)
+		os.WriteFile(path.Join(dir, file), []byte(file+"\n"), 0644)
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-m", "One")
+	runGit(t, dir, "update-index", "--index-version", "4")
+
+	n := NewNative(dir)
+	if hasChanges(t, n) {
+		t.Errorf("Unexpected changes reading a version 4 index")
+	}
+	os.WriteFile(path.Join(dir, "etc/hosts"), []byte("changed\n"), 0644)
+	if !hasChanges(t, n) {
+		t.Errorf("Expected changes reading a version 4 index")
+	}
+	if err := n.Add(dir); err != nil {
+		t.Fatalf("Error adding files: %s", err.Error())
+	}
+	if err := n.Commit("Two", testAuthor); err != nil {
+		t.Fatalf("Error committing: %s", err.Error())
+	}
+	if status := runGit(t, dir, "status", "--porcelain"); status != "" {
+		t.Errorf("Unexpected git status: %s", status)
+	}
+
+	runGit(t, dir, "update-index", "--split-index")
+	if _, err := n.HasChanges(); err == nil || !strings.Contains(err.Error(), "extension") {
+		t.Errorf("Expected an error reading a split index but got %v", err)
+	}
+	runGit(t, dir, "update-index", "--no-split-index")
+
+	runGit(t, dir, "checkout", "-b", "host2", "HEAD~1")
+	os.WriteFile(path.Join(dir, "etc/hosts"), []byte("conflict\n"), 0644)
+	runGit(t, dir, "commit", "-am", "Conflict")
+	cmd := exec.Command("git", "-c", "user.name=test", "-c", "user.email=test@example.com", "merge", "host1")
+	cmd.Dir = dir
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("Expected merge to conflict")
+	}
+	if _, err := n.HasChanges(); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("Expected a conflict reading an index with unmerged paths but got %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	n := NewMemory(dir)
+	if err := n.InitIfNeeded(); err != nil {
+		t.Fatalf("Error initializing repo: %s", err.Error())
+	}
+	os.WriteFile(path.Join(dir, "a"), []byte("a"), 0644)
+	os.WriteFile(path.Join(dir, "b"), []byte("b"), 0644)
+	if err := n.Add(dir); err != nil {
+		t.Fatalf("Error adding files: %s", err.Error())
+	}
+	if err := n.CommitPaths("Commit a", testAuthor, "a"); err != nil {
+		t.Fatalf("Error committing paths: %s", err.Error())
+	}
+	if !hasChanges(t, n) {
+		t.Errorf("Expected uncommitted path to be a change")
+	}
+	if _, err := n.ShowFile("HEAD", "b"); err == nil {
+		t.Errorf("Expected uncommitted path to not be in the commit")
+	}
+	if err := n.Commit("Commit b", testAuthor); err != nil {
+		t.Fatalf("Error committing: %s", err.Error())
+	}
+	if hasChanges(t, n) {
+		t.Errorf("Unexpected changes after commit")
+	}
+	if data, err := n.ShowFile("HEAD~1", "a"); err != nil || string(data) != "a" {
+		t.Errorf("Unexpected contents: %s %v", data, err)
+	}
+	if _, err := os.Stat(path.Join(dir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("Expected no .git directory to be created")
+	}
+	if err := n.Push("origin", "master"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected push to be unsupported but got %v", err)
+	}
+	if _, err := NewMemory(t.TempDir()).HasChanges(); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Expected an uninitialized repository to not be a repository but got %v", err)
+	}
+	if _, err := NewMemory(t.TempDir()).BranchExists("master"); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Expected an uninitialized repository to not be a repository but got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	objectCommit = "commit"
+	objectTree   = "tree"
+	objectBlob   = "blob"
+	objectTag    = "tag"
+)
+
+const (
+	modeTree       = 0040000
+	modeFile       = 0100644
+	modeExecutable = 0100755
+	modeSymlink    = 0120000
+)
+
+// hashObject get the hash of an object with the given type and contents
+func hashObject(objectType string, data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", objectType, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isHash(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	return isHex(s)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+// treeEntryT describes a single entry of a tree object
+type treeEntryT struct {
+	Mode uint32
+	Name string
+	Hash string
+}
+
+func (e treeEntryT) isTree() bool {
+	return e.Mode == modeTree
+}
+
+func parseTree(data []byte) ([]treeEntryT, error) {
+	entries := []treeEntryT{}
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		if space < 0 {
+			return nil, fmt.Errorf("invalid tree entry")
+		}
+		mode, err := strconv.ParseUint(string(data[:space]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tree entry mode: %s", err.Error())
+		}
+		data = data[space+1:]
+		null := bytes.IndexByte(data, 0)
+		if null < 0 || len(data) < null+21 {
+			return nil, fmt.Errorf("invalid tree entry")
+		}
+		entries = append(entries, treeEntryT{
+			Mode: uint32(mode),
+			Name: string(data[:null]),
+			Hash: hex.EncodeToString(data[null+1 : null+21]),
+		})
+		data = data[null+21:]
+	}
+	return entries, nil
+}
+
+// encodeTree encode the tree entries, sorting them in the order git expects
+func encodeTree(entries []treeEntryT) []byte {
+	sortName := func(e treeEntryT) string {
+		if e.isTree() {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		hash, _ := hex.DecodeString(entry.Hash)
+		fmt.Fprintf(&buf, "%o %s\x00", entry.Mode, entry.Name)
+		buf.Write(hash)
+	}
+	return buf.Bytes()
+}
+
+// commitT describes a commit object
+type commitT struct {
+	Tree    string
+	Parents []string
+	// The author and committer signatures, in the form 'Name <email> timestamp timezone'
+	Author    string
+	Committer string
+	Message   string
+}
+
+// Time get the time the commit was made
+func (c *commitT) Time() time.Time {
+	fields := strings.Fields(c.Committer)
+	if len(fields) < 2 {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// author get the author of the commit without the timestamp, in the form 'Name <email>'
+func (c *commitT) author() string {
+	name, _, _ := strings.Cut(c.Author, "> ")
+	return name + ">"
+}
+
+func parseCommit(data []byte) (*commitT, error) {
+	commit := commitT{}
+	header, message, _ := bytes.Cut(data, []byte("\n\n"))
+	commit.Message = string(message)
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			commit.Author = value
+		case "committer":
+			commit.Committer = value
+		}
+	}
+	if !isHash(commit.Tree) {
+		return nil, fmt.Errorf("invalid commit: missing tree")
+	}
+	return &commit, nil
+}
+
+func encodeCommit(commit commitT) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", commit.Tree)
+	for _, parent := range commit.Parents {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&buf, "author %s\n", commit.Author)
+	fmt.Fprintf(&buf, "committer %s\n", commit.Committer)
+	fmt.Fprintf(&buf, "\n%s", commit.Message)
+	return buf.Bytes()
+}
+
+// tagT describes an annotated tag object
+type tagT struct {
+	Object string
+	Type   string
+	Name   string
+	// The tagger signature, in the form 'Name <email> timestamp timezone'
+	Tagger  string
+	Message string
+}
+
+// Time get the time the tag was made
+func (t *tagT) Time() time.Time {
+	return (&commitT{Committer: t.Tagger}).Time()
+}
+
+func parseTag(data []byte) (*tagT, error) {
+	tag := tagT{}
+	header, message, _ := bytes.Cut(data, []byte("\n\n"))
+	tag.Message = string(message)
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			tag.Tagger = value
+		}
+	}
+	if !isHash(tag.Object) {
+		return nil, fmt.Errorf("invalid tag: missing object")
+	}
+	return &tag, nil
+}
+
+func encodeTag(tag tagT) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\n", tag.Object)
+	fmt.Fprintf(&buf, "type %s\n", tag.Type)
+	fmt.Fprintf(&buf, "tag %s\n", tag.Name)
+	fmt.Fprintf(&buf, "tagger %s\n", tag.Tagger)
+	fmt.Fprintf(&buf, "\n%s", tag.Message)
+	return buf.Bytes()
+}
+
+// signature format the author as a git signature at the given time
+func signature(author string, at time.Time) (string, error) {
+	match := authorPattern.FindStringSubmatch(author)
+	if match == nil {
+		return "", fmt.Errorf("invalid author '%s'", author)
+	}
+	return fmt.Sprintf("%s <%s> %d %s", match[1], match[2], at.Unix(), at.Format("-0700")), nil
+}
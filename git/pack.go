@@ -0,0 +1,257 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	packObjectCommit   = 1
+	packObjectTree     = 2
+	packObjectBlob     = 3
+	packObjectTag      = 4
+	packObjectOfsDelta = 6
+	packObjectRefDelta = 7
+)
+
+// maxDeltaDepth is the longest chain of deltas that will be followed
+const maxDeltaDepth = 50
+
+var packIndexMagic = []byte{0xff, 't', 'O', 'c'}
+
+// packIndexT describes a version 2 pack index and the pack file it belongs to
+type packIndexT struct {
+	packPath string
+	data     []byte
+	count    int
+}
+
+func loadPackIndex(idxPath string) (*packIndexT, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], packIndexMagic) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index '%s'", idxPath)
+	}
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+	if len(data) < 8+256*4+count*(20+4+4)+40 {
+		return nil, fmt.Errorf("truncated pack index '%s'", idxPath)
+	}
+	return &packIndexT{
+		packPath: strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		data:     data,
+		count:    count,
+	}, nil
+}
+
+func (p *packIndexT) hash(i int) []byte {
+	start := 8 + 256*4 + i*20
+	return p.data[start : start+20]
+}
+
+func (p *packIndexT) offset(i int) int64 {
+	offsets := 8 + 256*4 + p.count*(20+4)
+	offset := binary.BigEndian.Uint32(p.data[offsets+i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset)
+	}
+	large := offsets + p.count*4 + int(offset&0x7fffffff)*8
+	return int64(binary.BigEndian.Uint64(p.data[large:]))
+}
+
+// find get the offset of the object in the pack file
+func (p *packIndexT) find(hash string) (int64, bool) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return 0, false
+	}
+	start := 0
+	if raw[0] > 0 {
+		start = int(binary.BigEndian.Uint32(p.data[8+(int(raw[0])-1)*4:]))
+	}
+	end := int(binary.BigEndian.Uint32(p.data[8+int(raw[0])*4:]))
+	i := start + sort.Search(end-start, func(i int) bool {
+		return bytes.Compare(p.hash(start+i), raw) >= 0
+	})
+	if i < end && bytes.Equal(p.hash(i), raw) {
+		return p.offset(i), true
+	}
+	return 0, false
+}
+
+// findPrefix get the hashes of all objects in the pack that start with prefix
+func (p *packIndexT) findPrefix(prefix string) []string {
+	hashes := []string{}
+	for i := 0; i < p.count; i++ {
+		hash := hex.EncodeToString(p.hash(i))
+		if strings.HasPrefix(hash, prefix) {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// readPackObject read the object at offset in the pack file. Deltas against objects outside of the pack are resolved
+// with readObject.
+func readPackObject(f *os.File, offset int64, readObject func(hash string) (string, []byte, error), depth int) (string, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, fmt.Errorf("delta chain too long")
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, offset, math.MaxInt64-offset))
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	objectType := (b >> 4) & 7
+	size := uint64(b & 0x0f)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = r.ReadByte(); err != nil {
+			return "", nil, err
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+
+	var baseType string
+	var base []byte
+	switch objectType {
+	case packObjectOfsDelta:
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = r.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			distance = ((distance + 1) << 7) | int64(b&0x7f)
+		}
+		if distance <= 0 || distance > offset {
+			return "", nil, fmt.Errorf("invalid delta offset")
+		}
+		baseType, base, err = readPackObject(f, offset-distance, readObject, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	case packObjectRefDelta:
+		raw := make([]byte, 20)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return "", nil, err
+		}
+		baseType, base, err = readObject(hex.EncodeToString(raw))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return "", nil, err
+	}
+
+	switch objectType {
+	case packObjectCommit:
+		return objectCommit, data, nil
+	case packObjectTree:
+		return objectTree, data, nil
+	case packObjectBlob:
+		return objectBlob, data, nil
+	case packObjectTag:
+		return objectTag, data, nil
+	case packObjectOfsDelta, packObjectRefDelta:
+		data, err := applyDelta(base, data)
+		if err != nil {
+			return "", nil, err
+		}
+		return baseType, data, nil
+	}
+	return "", nil, fmt.Errorf("unknown pack object type %d", objectType)
+}
+
+func deltaHeaderSize(delta []byte) (int, []byte, error) {
+	size := 0
+	for shift := 0; ; shift += 7 {
+		if len(delta) == 0 {
+			return 0, nil, fmt.Errorf("truncated delta")
+		}
+		b := delta[0]
+		delta = delta[1:]
+		size |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+}
+
+// applyDelta apply the delta instructions to the base object
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := deltaHeaderSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch")
+	}
+	resultSize, delta, err := deltaHeaderSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		instruction := delta[0]
+		delta = delta[1:]
+		if instruction&0x80 != 0 {
+			var offset, size int
+			for i := 0; i < 7; i++ {
+				if instruction&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, fmt.Errorf("truncated delta")
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					size |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, fmt.Errorf("delta copy out of range")
+			}
+			result = append(result, base[offset:offset+size]...)
+		} else if instruction != 0 {
+			if int(instruction) > len(delta) {
+				return nil, fmt.Errorf("truncated delta")
+			}
+			result = append(result, delta[:instruction]...)
+			delta = delta[instruction:]
+		} else {
+			return nil, fmt.Errorf("invalid delta instruction")
+		}
+	}
+	if len(result) != resultSize {
+		return nil, fmt.Errorf("delta result size mismatch")
+	}
+	return result, nil
+}
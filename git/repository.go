@@ -0,0 +1,78 @@
+package git
+
+import "errors"
+
+// ErrUnsupported is returned when a repository does not support an operation
+var ErrUnsupported = errors.New("operation not supported")
+
+// Repository describes the version control operations used to sync files. Git uses the git binary, while Native is
+// implemented in Go and needs no git binary.
+type Repository interface {
+	// InitIfNeeded initialize a new repo if needed
+	InitIfNeeded() error
+	// CurrentBranch get the current branch
+	CurrentBranch() (*string, error)
+	// Checkout checkout a specific branch, creating it from the remote or the base branch if it does not exist locally
+	Checkout(branch string, options CheckoutOptions) error
+	// BranchExists does the local branch exist
+	BranchExists(branch string) (bool, error)
+	// HasChanges does the repo have any unstaged or untracked files
+	HasChanges() (bool, error)
+	// Add stage the files, including removed files
+	Add(files ...string) error
+	// Remove remove the files from the index and the work tree. Paths that are not tracked are still removed from the
+	// work tree so that they aren't added again.
+	Remove(filePath ...string) error
+	// Commit commit all staged changes. Returns ErrNothingToCommit if there are no staged changes.
+	Commit(message string, author string) error
+	// CommitPaths commit only the given paths, relative to the root of the repo
+	CommitPaths(message string, author string, paths ...string) error
+	// HeadCommit get the hash of the current commit
+	HeadCommit() (*string, error)
+	// ShowFile get the contents of the file at the given revision, relative to the root of the repo
+	ShowFile(revision, filePath string) ([]byte, error)
+	// FileLog get the commits reachable from revision that changed the file, relative to the root of the repo, newest
+	// first
+	FileLog(revision, filePath string) ([]Commit, error)
+	// RevList get the hashes of the last count commits reachable from revision, oldest first
+	RevList(revision string, count int) ([]string, error)
+	// CreateTag create an annotated tag at revision. Returns ErrTagExists if a tag with the name already exists.
+	CreateTag(name, revision, message, author string) error
+	// Tags get all tags, sorted by name
+	Tags() ([]Tag, error)
+	// Divergence count the commits on local that are not on upstream, and on upstream that are not on local
+	Divergence(local, upstream string) (int, int, error)
+
+	// RemoteURL get the URL of the remote, or an empty string if the remote does not exist
+	RemoteURL(remote string) (string, error)
+	// SetRemote add the remote, or update its URL if it already exists
+	SetRemote(remote, url string) error
+	// Fetch fetch the remote
+	Fetch(remote string) error
+	// RemoteBranchExists does the remote-tracking branch exist
+	RemoteBranchExists(remote, branch string) (bool, error)
+	// Rebase rebase the current branch onto upstream, leaving the branch unchanged if it fails
+	Rebase(upstream, author string) error
+	// Merge merge upstream into the current branch, leaving the branch unchanged if it fails
+	Merge(upstream, author string) error
+	// Push push the local branch to the remote. Returns ErrNonFastForward if the remote has moved.
+	Push(remote, local string) error
+	// PushTags push the tags to the remote
+	PushTags(remote string, tags ...string) error
+}
+
+// Signer describes a repository that can sign commits and verify commit signatures
+type Signer interface {
+	// SetSigning set the options used to sign commits and verify signatures
+	SetSigning(options SigningOptions) error
+	// CommitSignatures get the signatures of the commit at revision and its ancestors, newest first
+	CommitSignatures(revision string, limit int) ([]CommitSignature, error)
+	// VerifyCommit check that the commit at revision has a good signature from a trusted key
+	VerifyCommit(revision string) error
+}
+
+var (
+	_ Repository = (*Git)(nil)
+	_ Signer     = (*Git)(nil)
+	_ Repository = (*Native)(nil)
+)
@@ -0,0 +1,154 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SigningFormatGPG sign commits with a GPG key
+	SigningFormatGPG = "gpg"
+	// SigningFormatSSH sign commits with an SSH key
+	SigningFormatSSH = "ssh"
+)
+
+// ErrUnsignedCommit is returned when a commit has no signature
+var ErrUnsignedCommit = errors.New("commit is not signed")
+
+// ErrBadSignature is returned when a commit has a signature that is invalid or can not be trusted
+var ErrBadSignature = errors.New("commit signature is not valid")
+
+// SigningOptions describes how commits are signed and verified
+type SigningOptions struct {
+	// The signature format. One of SigningFormatGPG or SigningFormatSSH.
+	Format string
+	// The GPG key ID, or the path to the SSH private or public key, used to sign commits. If empty commits are not
+	// signed, but signatures can still be verified.
+	Key string
+	// Path to the SSH allowed signers file used to verify SSH signatures
+	AllowedSignersFile string
+}
+
+// CommitSignature describes the signature of a commit
+type CommitSignature struct {
+	Hash string
+	// The signature status, as reported by git's '%G?' format
+	Status string
+	// The signer of the commit, if known
+	Signer string
+}
+
+// SetSigning set the options used to sign commits and verify signatures
+func (g *Git) SetSigning(options SigningOptions) error {
+	switch options.Format {
+	case SigningFormatGPG, SigningFormatSSH:
+	default:
+		return fmt.Errorf("unsupported signing format '%s'", options.Format)
+	}
+	g.signing = &options
+	return nil
+}
+
+// config get the git config options for signing
+func (s *SigningOptions) config() []string {
+	if s == nil {
+		return []string{}
+	}
+	format := "openpgp"
+	if s.Format == SigningFormatSSH {
+		format = "ssh"
+	}
+	config := []string{"-c", "gpg.format=" + format}
+	if s.Key != "" {
+		config = append(config, "-c", "user.signingkey="+s.Key)
+	}
+	if s.AllowedSignersFile != "" {
+		config = append(config, "-c", "gpg.ssh.allowedSignersFile="+s.AllowedSignersFile)
+	}
+	return config
+}
+
+// commitArgs get the arguments to sign a commit
+func (s *SigningOptions) commitArgs() []string {
+	if s == nil || s.Key == "" {
+		return []string{}
+	}
+	return []string{"-S"}
+}
+
+// tagArgs get the arguments to create an annotated tag, signed if there is a key
+func (s *SigningOptions) tagArgs() []string {
+	if s == nil || s.Key == "" {
+		return []string{"-a"}
+	}
+	return []string{"-s"}
+}
+
+// Valid does the commit have a good signature from a trusted key
+func (s CommitSignature) Valid() bool {
+	return s.Status == "G"
+}
+
+// Err get the reason the signature is not valid, or nil if it is
+func (s CommitSignature) Err() error {
+	switch s.Status {
+	case "G":
+		return nil
+	case "N":
+		return ErrUnsignedCommit
+	case "B":
+		return fmt.Errorf("%w: bad signature", ErrBadSignature)
+	case "U":
+		return fmt.Errorf("%w: signed by an untrusted key", ErrBadSignature)
+	case "X":
+		return fmt.Errorf("%w: signature has expired", ErrBadSignature)
+	case "Y":
+		return fmt.Errorf("%w: signed by an expired key", ErrBadSignature)
+	case "R":
+		return fmt.Errorf("%w: signed by a revoked key", ErrBadSignature)
+	case "E":
+		return fmt.Errorf("%w: signature can not be checked", ErrBadSignature)
+	}
+	return fmt.Errorf("%w: unknown signature status '%s'", ErrBadSignature, s.Status)
+}
+
+// CommitSignatures get the signatures of the commit at revision and all of its ancestors, newest first. If limit is
+// greater than 0 at most that many commits are returned.
+func (g *Git) CommitSignatures(revision string, limit int) ([]CommitSignature, error) {
+	args := []string{"--format=%H%x00%G?%x00%GS"}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", limit))
+	}
+	args = append(args, revision, "--")
+	out, err := g.exec("log", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := []CommitSignature{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		signatures = append(signatures, CommitSignature{
+			Hash:   fields[0],
+			Status: fields[1],
+			Signer: fields[2],
+		})
+	}
+	return signatures, nil
+}
+
+// VerifyCommit check that the commit at revision has a good signature from a trusted key
+func (g *Git) VerifyCommit(revision string) error {
+	signatures, err := g.CommitSignatures(revision, 1)
+	if err != nil {
+		return err
+	}
+	if len(signatures) == 0 {
+		return fmt.Errorf("no commit found for revision '%s'", revision)
+	}
+	return signatures[0].Err()
+}
@@ -0,0 +1,404 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errNotFound is returned when an object or reference does not exist
+var errNotFound = errors.New("not found")
+
+// storage stores the objects, references, and index of a repository
+type storage interface {
+	initialized() bool
+	initialize(branch string) error
+	readObject(hash string) (string, []byte, error)
+	writeObject(objectType string, data []byte) (string, error)
+	findObjects(prefix string) ([]string, error)
+	// readRef get the raw value of the reference, either a hash or 'ref: ' followed by the name of another reference
+	readRef(name string) (string, error)
+	writeRef(name, value string) error
+	// listRefs get the names of all references that start with prefix, sorted
+	listRefs(prefix string) ([]string, error)
+	// readIndex get the contents of the index and when it was written, or nil if there is no index
+	readIndex() ([]byte, time.Time, error)
+	writeIndex(data []byte) error
+}
+
+// fileStorage stores the repository in a .git directory, compatible with the git binary. Objects are written loose,
+// but both loose and packed objects can be read.
+type fileStorage struct {
+	gitDir string
+	packs  []*packIndexT
+	once   sync.Once
+}
+
+// findGitDir get the path of the .git directory for the work tree, following a '.git' file if there is one
+func findGitDir(repoDir string) string {
+	gitDir := path.Join(repoDir, ".git")
+	data, err := os.ReadFile(gitDir)
+	if err != nil {
+		return gitDir
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return gitDir
+	}
+	if !filepath.IsAbs(target) {
+		target = path.Join(repoDir, target)
+	}
+	return target
+}
+
+func (s *fileStorage) initialized() bool {
+	_, err := os.Stat(path.Join(s.gitDir, "HEAD"))
+	return err == nil
+}
+
+func (s *fileStorage) initialize(branch string) error {
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(path.Join(s.gitDir, dir), 0755); err != nil {
+			return err
+		}
+	}
+	config := "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = false\n\tlogallrefupdates = true\n"
+	if err := writeFileAtomic(path.Join(s.gitDir, "config"), []byte(config), 0644); err != nil {
+		return err
+	}
+	return s.writeRef("HEAD", "ref: refs/heads/"+branch)
+}
+
+func (s *fileStorage) objectPath(hash string) string {
+	return path.Join(s.gitDir, "objects", hash[:2], hash[2:])
+}
+
+func (s *fileStorage) readObject(hash string) (string, []byte, error) {
+	if !isHash(hash) {
+		return "", nil, fmt.Errorf("invalid object name '%s'", hash)
+	}
+	f, err := os.Open(s.objectPath(hash))
+	if err == nil {
+		defer f.Close()
+		return readLooseObject(f)
+	}
+	if !os.IsNotExist(err) {
+		return "", nil, err
+	}
+
+	for _, pack := range s.packIndexes() {
+		offset, ok := pack.find(hash)
+		if !ok {
+			continue
+		}
+		f, err := os.Open(pack.packPath)
+		if err != nil {
+			return "", nil, err
+		}
+		defer f.Close()
+		return readPackObject(f, offset, s.readObject, 0)
+	}
+	return "", nil, fmt.Errorf("object %s %w", hash, errNotFound)
+}
+
+func readLooseObject(r io.Reader) (string, []byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, err
+	}
+	header, contents, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", nil, fmt.Errorf("invalid object header")
+	}
+	objectType, _, _ := strings.Cut(string(header), " ")
+	return objectType, contents, nil
+}
+
+func (s *fileStorage) packIndexes() []*packIndexT {
+	s.once.Do(func() {
+		idxPaths, _ := filepath.Glob(path.Join(s.gitDir, "objects", "pack", "*.idx"))
+		for _, idxPath := range idxPaths {
+			pack, err := loadPackIndex(idxPath)
+			if err != nil {
+				log.Warn("Ignoring pack: %s", err.Error())
+				continue
+			}
+			s.packs = append(s.packs, pack)
+		}
+	})
+	return s.packs
+}
+
+func (s *fileStorage) writeObject(objectType string, data []byte) (string, error) {
+	hash := hashObject(objectType, data)
+	objectPath := s.objectPath(hash)
+	if _, err := os.Stat(objectPath); err == nil {
+		return hash, nil
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	fmt.Fprintf(zw, "%s %d\x00", objectType, len(data))
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(path.Dir(objectPath), 0755); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(objectPath, buf.Bytes(), 0444); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *fileStorage) findObjects(prefix string) ([]string, error) {
+	hashes := map[string]bool{}
+	if len(prefix) >= 2 {
+		files, _ := os.ReadDir(path.Join(s.gitDir, "objects", prefix[:2]))
+		for _, file := range files {
+			hash := prefix[:2] + file.Name()
+			if isHash(hash) && strings.HasPrefix(hash, prefix) {
+				hashes[hash] = true
+			}
+		}
+	}
+	for _, pack := range s.packIndexes() {
+		for _, hash := range pack.findPrefix(prefix) {
+			hashes[hash] = true
+		}
+	}
+	return sortedKeys(hashes), nil
+}
+
+func (s *fileStorage) readRef(name string) (string, error) {
+	data, err := os.ReadFile(path.Join(s.gitDir, name))
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) && !errors.Is(err, syscall.EISDIR) {
+		return "", err
+	}
+
+	f, err := os.Open(path.Join(s.gitDir, "packed-refs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("reference '%s' %w", name, errNotFound)
+		}
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, refName, ok := strings.Cut(scanner.Text(), " ")
+		if ok && refName == name && isHash(hash) {
+			return hash, nil
+		}
+	}
+	return "", fmt.Errorf("reference '%s' %w", name, errNotFound)
+}
+
+func (s *fileStorage) writeRef(name, value string) error {
+	refPath := path.Join(s.gitDir, name)
+	if err := os.MkdirAll(path.Dir(refPath), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(refPath, []byte(value+"\n"), 0644)
+}
+
+func (s *fileStorage) listRefs(prefix string) ([]string, error) {
+	names := map[string]bool{}
+	err := filepath.WalkDir(path.Join(s.gitDir, prefix), func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.gitDir, walkPath)
+		if err != nil {
+			return err
+		}
+		names[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.Open(path.Join(s.gitDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return sortedKeys(names), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, refName, ok := strings.Cut(scanner.Text(), " ")
+		if ok && isHash(hash) && strings.HasPrefix(refName, prefix) {
+			names[refName] = true
+		}
+	}
+	return sortedKeys(names), scanner.Err()
+}
+
+func (s *fileStorage) readIndex() ([]byte, time.Time, error) {
+	indexPath := path.Join(s.gitDir, "index")
+	info, err := os.Stat(indexPath)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(indexPath)
+	return data, info.ModTime(), err
+}
+
+func (s *fileStorage) writeIndex(data []byte) error {
+	return writeFileAtomic(path.Join(s.gitDir, "index"), data, 0644)
+}
+
+// writeFileAtomic write the file using a lock file, the same way git does
+func writeFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	lockPath := filePath + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("unable to create '%s': file exists, another git process may be running", lockPath)
+		}
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(lockPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+	if err := os.Rename(lockPath, filePath); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+	return nil
+}
+
+// memoryStorage stores the repository in memory
+type memoryStorage struct {
+	objects   map[string]memoryObjectT
+	refs      map[string]string
+	index     []byte
+	indexTime time.Time
+}
+
+type memoryObjectT struct {
+	Type string
+	Data []byte
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		objects: map[string]memoryObjectT{},
+		refs:    map[string]string{},
+	}
+}
+
+func (s *memoryStorage) initialized() bool {
+	_, ok := s.refs["HEAD"]
+	return ok
+}
+
+func (s *memoryStorage) initialize(branch string) error {
+	s.refs["HEAD"] = "ref: refs/heads/" + branch
+	return nil
+}
+
+func (s *memoryStorage) readObject(hash string) (string, []byte, error) {
+	object, ok := s.objects[hash]
+	if !ok {
+		return "", nil, fmt.Errorf("object %s %w", hash, errNotFound)
+	}
+	return object.Type, object.Data, nil
+}
+
+func (s *memoryStorage) writeObject(objectType string, data []byte) (string, error) {
+	hash := hashObject(objectType, data)
+	s.objects[hash] = memoryObjectT{
+		Type: objectType,
+		Data: bytes.Clone(data),
+	}
+	return hash, nil
+}
+
+func (s *memoryStorage) findObjects(prefix string) ([]string, error) {
+	hashes := map[string]bool{}
+	for hash := range s.objects {
+		if strings.HasPrefix(hash, prefix) {
+			hashes[hash] = true
+		}
+	}
+	return sortedKeys(hashes), nil
+}
+
+func (s *memoryStorage) readRef(name string) (string, error) {
+	value, ok := s.refs[name]
+	if !ok {
+		return "", fmt.Errorf("reference '%s' %w", name, errNotFound)
+	}
+	return value, nil
+}
+
+func (s *memoryStorage) writeRef(name, value string) error {
+	s.refs[name] = value
+	return nil
+}
+
+func (s *memoryStorage) listRefs(prefix string) ([]string, error) {
+	names := map[string]bool{}
+	for name := range s.refs {
+		if strings.HasPrefix(name, prefix) {
+			names[name] = true
+		}
+	}
+	return sortedKeys(names), nil
+}
+
+func (s *memoryStorage) readIndex() ([]byte, time.Time, error) {
+	return s.index, s.indexTime, nil
+}
+
+func (s *memoryStorage) writeIndex(data []byte) error {
+	s.index = bytes.Clone(data)
+	s.indexTime = time.Now()
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
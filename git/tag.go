@@ -0,0 +1,83 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTagExists is returned when creating a tag with the same name as an existing tag
+var ErrTagExists = errors.New("tag already exists")
+
+// Tag describes a tag in the repository
+type Tag struct {
+	Name string
+	// The hash of the commit the tag points to
+	Commit string
+	// The subject of the tag message, or of the commit message for lightweight tags
+	Subject string
+	// When the tag was made, or when the commit was made for lightweight tags
+	Time time.Time
+}
+
+// subject get the first line of a tag or commit message
+func subject(message string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return line
+}
+
+// CreateTag create an annotated tag at revision. If signing is enabled the tag is signed. Returns ErrTagExists if a tag
+// with the name already exists.
+func (g *Git) CreateTag(name, revision, message, author string) error {
+	if _, err := g.exec("rev-parse", "--verify", "--quiet", "refs/tags/"+name); err == nil {
+		return fmt.Errorf("%w: %s", ErrTagExists, name)
+	}
+	args := append(g.signing.tagArgs(), "-m", message, name, revision)
+	_, err := g.execEnv(g.committerEnv(author), "tag", args...)
+	return err
+}
+
+// Tags get all tags, sorted by name
+func (g *Git) Tags() ([]Tag, error) {
+	out, err := g.exec("for-each-ref", "--format=%(refname)%00%(objectname)%00%(*objectname)%00%(creatordate:raw)%00%(contents:subject)", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	tags := []Tag{}
+	for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(string(line), "\x00")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected for-each-ref output: %s", line)
+		}
+		tag := Tag{
+			Name:    strings.TrimPrefix(fields[0], "refs/tags/"),
+			Commit:  fields[1],
+			Subject: fields[4],
+		}
+		if fields[2] != "" {
+			tag.Commit = fields[2]
+		}
+		date, _, _ := strings.Cut(fields[3], " ")
+		if seconds, err := strconv.ParseInt(date, 10, 64); err == nil {
+			tag.Time = time.Unix(seconds, 0)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// PushTags push the tags to the remote
+func (g *Git) PushTags(remote string, tags ...string) error {
+	args := []string{remote}
+	for _, tag := range tags {
+		args = append(args, "refs/tags/"+tag)
+	}
+	_, err := g.exec("push", args...)
+	return err
+}
@@ -0,0 +1,64 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	t.Parallel()
+
+	forEachBackend(t, func(t *testing.T, dir string, repo Repository) {
+		os.WriteFile(path.Join(dir, "hosts"), []byte("one\n"), 0644)
+		if err := repo.Add(dir); err != nil {
+			t.Fatalf("Error adding files: %s", err.Error())
+		}
+		if err := repo.Commit("One", testAuthor); err != nil {
+			t.Fatalf("Error committing: %s", err.Error())
+		}
+		first, _ := repo.HeadCommit()
+		if err := repo.CreateTag("pre-upgrade", "HEAD", "Before the upgrade", testAuthor); err != nil {
+			t.Fatalf("Error creating tag: %s", err.Error())
+		}
+		if err := repo.CreateTag("pre-upgrade", "HEAD", "Again", testAuthor); !errors.Is(err, ErrTagExists) {
+			t.Errorf("Expected tag to already exist but got %v", err)
+		}
+
+		os.WriteFile(path.Join(dir, "hosts"), []byte("two\n"), 0644)
+		if err := repo.Add(dir); err != nil {
+			t.Fatalf("Error adding files: %s", err.Error())
+		}
+		if err := repo.Commit("Two", testAuthor); err != nil {
+			t.Fatalf("Error committing: %s", err.Error())
+		}
+		runGit(t, dir, "tag", "lightweight")
+
+		tags, err := repo.Tags()
+		if err != nil {
+			t.Fatalf("Error listing tags: %s", err.Error())
+		}
+		if len(tags) != 2 {
+			t.Fatalf("Unexpected tags: %+v", tags)
+		}
+		if tags[0].Name != "lightweight" || tags[0].Subject != "Two" || tags[0].Time.IsZero() {
+			t.Errorf("Unexpected lightweight tag: %+v", tags[0])
+		}
+		if tags[1].Name != "pre-upgrade" || tags[1].Commit != *first || tags[1].Subject != "Before the upgrade" || tags[1].Time.IsZero() {
+			t.Errorf("Unexpected annotated tag: %+v", tags[1])
+		}
+		if data, err := repo.ShowFile("pre-upgrade", "hosts"); err != nil || string(data) != "one\n" {
+			t.Errorf("Unexpected contents at tag: %s %v", data, err)
+		}
+
+		runGit(t, dir, "fsck", "--strict")
+		if message := runGit(t, dir, "tag", "-l", "-n1", "pre-upgrade"); message != "pre-upgrade     Before the upgrade" {
+			t.Errorf("Unexpected tag message: %s", message)
+		}
+		runGit(t, dir, "pack-refs", "--all")
+		if tags, err := repo.Tags(); err != nil || len(tags) != 2 {
+			t.Errorf("Unexpected packed tags: %+v %v", tags, err)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package configsync
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
+// HistoryOptions describes the options for looking up the history of a synced file
+type HistoryOptions struct {
+	// The git working directory where synced files are saved
+	WorkDir string
+	// Git options
+	Git GitOptionsType
+	// The absolute path of the synced file or command output on the system
+	Path string
+	// The revision (commit hash, branch, or tag) to look up. Defaults to the branch name or hostname of the system.
+	Revision string
+	// If set, the file is shown as it was at this time in the history of the revision
+	At time.Time
+	// The key used to decrypt encrypted files. Required to show encrypted files.
+	EncryptionKey []byte
+}
+
+// ShowReport describes a synced file as it was at a point in its history
+type ShowReport struct {
+	// The hash of the commit the file was read from
+	Commit string
+	// The contents of the file, decrypted if it was encrypted
+	Data []byte
+}
+
+// historyPath get the path of the synced file relative to the root of the work directory, the same as it is synced to.
+// Paths outside of the work directory are rejected.
+func historyPath(workDir, filePath string) (string, error) {
+	if !path.IsAbs(filePath) {
+		return "", fmt.Errorf("path '%s' is not absolute", filePath)
+	}
+	rel, err := filepath.Rel(workDir, path.Join(workDir, path.Clean(filePath)))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("path '%s' can not be synced", filePath)
+	}
+	return rel, nil
+}
+
+// Log get the commits that changed the synced file or command output, newest first
+func Log(ctx context.Context, options HistoryOptions) ([]git.Commit, error) {
+	repoPath, err := historyPath(options.WorkDir, options.Path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := options.Git.openGit(options.WorkDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error opening git instance: %s", err.Error())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	revision := options.Git.hostRevision(options.Revision)
+	commits, err := g.FileLog(revision, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting history of '%s': %s", options.Path, err.Error())
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("path '%s' has not been synced in '%s'", options.Path, revision)
+	}
+	return commits, nil
+}
+
+// Show get the contents of the synced file or command output at the revision, or as it was at a point in time.
+// Encrypted files are decrypted.
+func Show(ctx context.Context, options HistoryOptions) (*ShowReport, error) {
+	repoPath, err := historyPath(options.WorkDir, options.Path)
+	if err != nil {
+		return nil, err
+	}
+	encrypter, err := EncryptionOptionsType{Key: options.EncryptionKey}.encrypter()
+	if err != nil {
+		return nil, err
+	}
+	g, err := options.Git.openGit(options.WorkDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error opening git instance: %s", err.Error())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	revision := options.Git.hostRevision(options.Revision)
+	report := &ShowReport{}
+	if options.At.IsZero() {
+		commits, err := g.RevList(revision, 1)
+		if err != nil || len(commits) == 0 {
+			return nil, fmt.Errorf("unknown revision '%s': %v", revision, err)
+		}
+		report.Commit = commits[0]
+	} else {
+		commits, err := g.FileLog(revision, repoPath)
+		if err != nil {
+			return nil, fmt.Errorf("error getting history of '%s': %s", options.Path, err.Error())
+		}
+		for _, commit := range commits {
+			if !commit.Time.After(options.At) {
+				report.Commit = commit.Hash
+				break
+			}
+		}
+		if report.Commit == "" {
+			return nil, fmt.Errorf("path '%s' had not been synced at %s", options.Path, options.At.Format(time.RFC3339))
+		}
+	}
+
+	data, err := g.ShowFile(report.Commit, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("path '%s' does not exist at commit %s", options.Path, report.Commit)
+	}
+	metadata, err := loadMetaAtRevision(g, report.Commit)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range metadata.Files {
+		if file.Path != path.Clean(options.Path) || !file.Encrypted {
+			continue
+		}
+		if data, err = encrypter.decrypt(file.Path, data); err != nil {
+			return nil, err
+		}
+		break
+	}
+	report.Data = data
+	return report, nil
+}
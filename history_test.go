@@ -0,0 +1,28 @@
+package configsync
+
+import "testing"
+
+func TestHistoryPath(t *testing.T) {
+	t.Parallel()
+
+	for filePath, expected := range map[string]string{
+		"/etc/passwd":            "etc/passwd",
+		"/../etc/passwd":         "etc/passwd",
+		"/etc/../../etc/passwd":  "etc/passwd",
+		"/etc/ssh/../hosts":      "etc/hosts",
+		"/etc/ssh/sshd_config/.": "etc/ssh/sshd_config",
+	} {
+		rel, err := historyPath("/root/configuration_files", filePath)
+		if err != nil {
+			t.Errorf("Unexpected error for '%s': %s", filePath, err.Error())
+		} else if rel != expected {
+			t.Errorf("Unexpected path for '%s': %s", filePath, rel)
+		}
+	}
+
+	for _, filePath := range []string{"/", "/..", "/../..", "etc/passwd", "../etc/passwd", ".."} {
+		if rel, err := historyPath("/root/configuration_files", filePath); err == nil {
+			t.Errorf("Expected an error for '%s' but got %s", filePath, rel)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package configsync
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultCommitMessageTemplate is the commit message template used if none is specified. The reason is used as the
+// subject if one is given, followed by the paths that changed.
+const DefaultCommitMessageTemplate = `{{if .Reason}}{{.Reason}}{{else}}Automatic config sync{{end}}
+{{range .Added}}
+A {{.}}{{end}}{{range .Modified}}
+M {{.}}{{end}}{{range .Removed}}
+D {{.}}{{end}}
+`
+
+// CommitMessageDataType describes the data available to commit message templates
+type CommitMessageDataType struct {
+	// The hostname of the system
+	Hostname string
+	// The branch being committed to
+	Branch string
+	// When the sync started
+	Time time.Time
+	// The version of configsync, if known
+	Version string
+	// The reason given for the sync, if any
+	Reason string
+	// The source group or file path being committed, when committing per source or per file
+	Source string
+	// Paths of files and command outputs that were added
+	Added []string
+	// Paths of files and command outputs that were modified
+	Modified []string
+	// Paths of files and command outputs that were removed
+	Removed []string
+}
+
+// commitMessageTemplate parse the commit message template, using the default if none is specified
+func (o GitOptionsType) commitMessageTemplate() (*template.Template, error) {
+	text := o.MessageTemplate
+	if text == "" {
+		text = DefaultCommitMessageTemplate
+	}
+	tmpl, err := template.New("message").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit message template: %s", err.Error())
+	}
+	return tmpl, nil
+}
+
+// renderCommitMessage render the commit message template with the given data
+func renderCommitMessage(tmpl *template.Template, data CommitMessageDataType) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering commit message: %s", err.Error())
+	}
+	message := strings.TrimSpace(buf.String())
+	if message == "" {
+		return "", fmt.Errorf("commit message template produced an empty message")
+	}
+	return message, nil
+}
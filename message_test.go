@@ -0,0 +1,60 @@
+package configsync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommitMessage(t *testing.T) {
+	data := CommitMessageDataType{
+		Hostname: "db1",
+		Time:     time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC),
+		Version:  "1.2.3",
+		Added:    []string{"/etc/a"},
+		Modified: []string{"/etc/b", "/etc/c"},
+		Removed:  []string{"/etc/d"},
+	}
+
+	tmpl, err := GitOptionsType{}.commitMessageTemplate()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing template: %s", err.Error())
+	}
+	message, err := renderCommitMessage(tmpl, data)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering message: %s", err.Error())
+	}
+	expected := "Automatic config sync\n\nA /etc/a\nM /etc/b\nM /etc/c\nD /etc/d"
+	if message != expected {
+		t.Errorf("Unexpected message. Expected %q got %q", expected, message)
+	}
+
+	data.Reason = "CHG-1234"
+	message, _ = renderCommitMessage(tmpl, data)
+	if message[:9] != "CHG-1234\n" {
+		t.Errorf("Expected reason to be used as the subject: %q", message)
+	}
+
+	tmpl, err = GitOptionsType{
+		MessageTemplate: `{{.Hostname}} {{.Time.Format "2006-01-02"}} v{{.Version}}: {{join .Modified ", "}}`,
+	}.commitMessageTemplate()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing template: %s", err.Error())
+	}
+	message, _ = renderCommitMessage(tmpl, data)
+	expected = "db1 2026-10-18 v1.2.3: /etc/b, /etc/c"
+	if message != expected {
+		t.Errorf("Unexpected message. Expected %q got %q", expected, message)
+	}
+
+	if _, err := (GitOptionsType{MessageTemplate: "{{.Hostname"}).commitMessageTemplate(); err == nil {
+		t.Errorf("Expected error for invalid template")
+	}
+	tmpl, _ = GitOptionsType{MessageTemplate: "{{.DoesNotExist}}"}.commitMessageTemplate()
+	if _, err := renderCommitMessage(tmpl, data); err == nil {
+		t.Errorf("Expected error for unknown field")
+	}
+	tmpl, _ = GitOptionsType{MessageTemplate: "{{if false}}x{{end}}"}.commitMessageTemplate()
+	if _, err := renderCommitMessage(tmpl, data); err == nil {
+		t.Errorf("Expected error for empty message")
+	}
+}
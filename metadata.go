@@ -2,9 +2,15 @@ package configsync
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"time"
+
+	"github.com/ecnepsnai/configsync/git"
 )
 
+const metadataFileName = "configsync_meta.json"
+
 type metadataType struct {
 	Files []fileType
 }
@@ -14,6 +20,12 @@ type fileType struct {
 	Hash   uint64
 	Info   fileInfoType
 	Source string
+	// If secrets were redacted from the synced copy of the file
+	Redacted bool `json:",omitempty"`
+	// If the synced copy of the file is encrypted. The hash is always of the unencrypted content.
+	Encrypted bool `json:",omitempty"`
+	// Information about the command that produced the file, for command outputs
+	Command *commandInfoType `json:",omitempty"`
 }
 
 type fileInfoType struct {
@@ -22,6 +34,15 @@ type fileInfoType struct {
 	GID  int
 }
 
+type commandInfoType struct {
+	// The exit status of the command, or -1 if it could not be run
+	ExitCode int
+	// How long the command took to run when it produced the synced output
+	Duration time.Duration
+	// If the most recent run of the command failed and the synced output is from an earlier run
+	Stale bool `json:",omitempty"`
+}
+
 func tryLoadMeta(metaPath string) *metadataType {
 	log.Debug("Trying to read metadata...")
 
@@ -52,34 +73,51 @@ func tryLoadMeta(metaPath string) *metadataType {
 	return &metadata
 }
 
-func saveMetadata(metaPath string, metadata *metadataType) {
+// loadMetaAtRevision load the metadata from a specific revision in the git repo
+func loadMetaAtRevision(g git.Repository, revision string) (*metadataType, error) {
+	data, err := g.ShowFile(revision, metadataFileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata at revision '%s': %s", revision, err.Error())
+	}
+	metadata := metadataType{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("error decoding metadata at revision '%s': %s", revision, err.Error())
+	}
+	return &metadata, nil
+}
+
+func saveMetadata(metaPath string, metadata *metadataType) error {
 	syncPath := metaPath + ".atomic"
-	f, err := os.OpenFile(syncPath, os.O_WRONLY|os.O_CREATE, 0644)
+	f, err := os.OpenFile(syncPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		log.PFatal("Error opening atomic path for metadata", map[string]interface{}{
+		log.PError("Error opening atomic path for metadata", map[string]interface{}{
 			"atomic_path": syncPath,
 			"file_path":   metaPath,
 			"error":       err.Error(),
 		})
+		return fmt.Errorf("error opening atomic path for metadata: %s", err.Error())
 	}
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "  ")
 	if err := enc.Encode(metadata); err != nil {
 		f.Close()
-		log.PFatal("Error encoding metadata JSON", map[string]interface{}{
+		log.PError("Error encoding metadata JSON", map[string]interface{}{
 			"atomic_path": syncPath,
 			"file_path":   metaPath,
 			"error":       err.Error(),
 		})
+		return fmt.Errorf("error encoding metadata JSON: %s", err.Error())
 	}
 	f.Close()
 
 	if err := os.Rename(syncPath, metaPath); err != nil {
-		log.PFatal("Error encoding metadata JSON", map[string]interface{}{
+		log.PError("Error writing metadata JSON", map[string]interface{}{
 			"atomic_path": syncPath,
 			"file_path":   metaPath,
 			"error":       err.Error(),
 		})
+		return fmt.Errorf("error writing metadata JSON: %s", err.Error())
 	}
 	log.Debug("Synced metadata")
+	return nil
 }
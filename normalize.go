@@ -0,0 +1,208 @@
+package configsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NormalizeStepType describes a single step used to normalize the output of a command before it is hashed and
+// written. Exactly one action must be set on each step.
+type NormalizeStepType struct {
+	// Delete lines matching this regular expression
+	Delete string `toml:"delete"`
+	// Replace matches of this regular expression with With
+	Replace string `toml:"replace"`
+	// The replacement text for Replace. Capture groups can be referenced with $1, ${name}, etc.
+	With string `toml:"with"`
+	// Sort lines
+	Sort bool `toml:"sort"`
+	// Parse the output as JSON and re-encode it with sorted keys and stable indentation
+	JSON bool `toml:"json"`
+	// 1-based column numbers to remove from every line
+	DropColumns []int `toml:"drop_columns"`
+	// The column separator for DropColumns. If empty, columns are separated by whitespace and joined with a single space.
+	Separator string `toml:"separator"`
+}
+
+type normalizeStepT func(data []byte) ([]byte, error)
+
+type normalizerT struct {
+	steps []normalizeStepT
+}
+
+// normalizer compile the normalization steps of the command. Returns nil if there are no steps.
+func (c CommandType) normalizer() (*normalizerT, error) {
+	if len(c.Normalize) == 0 {
+		return nil, nil
+	}
+
+	n := &normalizerT{}
+	for i, step := range c.Normalize {
+		compiled, err := step.compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid normalize step %d: %s", i+1, err.Error())
+		}
+		n.steps = append(n.steps, compiled)
+	}
+	return n, nil
+}
+
+func (s NormalizeStepType) compile() (normalizeStepT, error) {
+	actions := 0
+	for _, set := range []bool{s.Delete != "", s.Replace != "", s.Sort, s.JSON, len(s.DropColumns) > 0} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return nil, fmt.Errorf("exactly one of delete, replace, sort, json, or drop_columns must be set")
+	}
+
+	switch {
+	case s.Delete != "":
+		re, err := regexp.Compile(s.Delete)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", s.Delete, err.Error())
+		}
+		return func(data []byte) ([]byte, error) {
+			return deleteLines(data, re), nil
+		}, nil
+	case s.Replace != "":
+		re, err := regexp.Compile(s.Replace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", s.Replace, err.Error())
+		}
+		with := []byte(s.With)
+		return func(data []byte) ([]byte, error) {
+			return re.ReplaceAll(data, with), nil
+		}, nil
+	case s.Sort:
+		return func(data []byte) ([]byte, error) {
+			return sortLines(data), nil
+		}, nil
+	case s.JSON:
+		return canonicalizeJSON, nil
+	default:
+		for _, column := range s.DropColumns {
+			if column < 1 {
+				return nil, fmt.Errorf("invalid column %d: columns start at 1", column)
+			}
+		}
+		columns := s.DropColumns
+		separator := s.Separator
+		return func(data []byte) ([]byte, error) {
+			return dropColumns(data, columns, separator), nil
+		}, nil
+	}
+}
+
+// normalize run all steps against the data
+func (n *normalizerT) normalize(data []byte) ([]byte, error) {
+	if n == nil {
+		return data, nil
+	}
+	var err error
+	for _, step := range n.steps {
+		data, err = step(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// splitOutputLines split data into lines, returning if the data ended with a newline
+func splitOutputLines(data []byte) ([]string, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	text := string(data)
+	trailingNewline := strings.HasSuffix(text, "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n"), trailingNewline
+}
+
+func joinLines(lines []string, trailingNewline bool) []byte {
+	if len(lines) == 0 {
+		return []byte{}
+	}
+	text := strings.Join(lines, "\n")
+	if trailingNewline {
+		text += "\n"
+	}
+	return []byte(text)
+}
+
+func deleteLines(data []byte, re *regexp.Regexp) []byte {
+	lines, trailingNewline := splitOutputLines(data)
+	kept := []string{}
+	for _, line := range lines {
+		if !re.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	return joinLines(kept, trailingNewline)
+}
+
+func sortLines(data []byte) []byte {
+	lines, trailingNewline := splitOutputLines(data)
+	sort.Strings(lines)
+	return joinLines(lines, trailingNewline)
+}
+
+func dropColumns(data []byte, columns []int, separator string) []byte {
+	drop := map[int]bool{}
+	for _, column := range columns {
+		drop[column-1] = true
+	}
+
+	lines, trailingNewline := splitOutputLines(data)
+	for i, line := range lines {
+		var fields []string
+		joiner := separator
+		if separator == "" {
+			fields = strings.Fields(line)
+			joiner = " "
+		} else {
+			fields = strings.Split(line, separator)
+		}
+		kept := []string{}
+		for column, field := range fields {
+			if !drop[column] {
+				kept = append(kept, field)
+			}
+		}
+		lines[i] = strings.Join(kept, joiner)
+	}
+	return joinLines(lines, trailingNewline)
+}
+
+// canonicalizeJSON re-encode JSON with sorted keys and two space indentation. Numbers are kept as they were written.
+// Output with multiple values, such as newline delimited JSON, has each value re-encoded in order.
+func canonicalizeJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	for count := 0; ; count++ {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF && count > 0 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing JSON output: %s", err.Error())
+		}
+		if err := encoder.Encode(value); err != nil {
+			return nil, fmt.Errorf("error encoding JSON output: %s", err.Error())
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package configsync
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	normalizer, err := CommandType{
+		Normalize: []NormalizeStepType{
+			{Delete: `^\s*RX packets`},
+			{Replace: `valid_lft \d+sec`, With: "valid_lft <n>"},
+			{DropColumns: []int{1}},
+			{Sort: true},
+		},
+	}.normalizer()
+	if err != nil {
+		t.Fatalf("Unexpected error compiling steps: %s", err.Error())
+	}
+
+	input := "2 eth0 up valid_lft 3600sec\n    RX packets 1234\n1 lo up valid_lft 100sec\n"
+	expected := "eth0 up valid_lft <n>\nlo up valid_lft <n>\n"
+	result, err := normalizer.normalize([]byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error normalizing output: %s", err.Error())
+	}
+	if string(result) != expected {
+		t.Errorf("Unexpected output. Expected %q got %q", expected, result)
+	}
+
+	columns := dropColumns([]byte("a:b:c\nd:e:f"), []int{2, 3}, ":")
+	if string(columns) != "a\nd" {
+		t.Errorf("Unexpected output dropping columns: %q", columns)
+	}
+
+	var nilNormalizer *normalizerT
+	if result, _ := nilNormalizer.normalize([]byte("x")); string(result) != "x" {
+		t.Errorf("Nil normalizer should not change output")
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	result, err := canonicalizeJSON([]byte(`{"b": [3, 1.50], "a": {"d": "<x>", "c": null}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error canonicalizing JSON: %s", err.Error())
+	}
+	expected := "{\n  \"a\": {\n    \"c\": null,\n    \"d\": \"<x>\"\n  },\n  \"b\": [\n    3,\n    1.50\n  ]\n}\n"
+	if string(result) != expected {
+		t.Errorf("Unexpected output. Expected %q got %q", expected, result)
+	}
+
+	if _, err := canonicalizeJSON([]byte("not json")); err == nil {
+		t.Errorf("Expected error for invalid JSON")
+	}
+
+	// Every value in the output is kept
+	result, err = canonicalizeJSON([]byte("{\"b\": 1, \"a\": 2}\n{\"d\": 3, \"c\": 4}\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error canonicalizing JSON: %s", err.Error())
+	}
+	expected = "{\n  \"a\": 2,\n  \"b\": 1\n}\n{\n  \"c\": 4,\n  \"d\": 3\n}\n"
+	if string(result) != expected {
+		t.Errorf("Unexpected output. Expected %q got %q", expected, result)
+	}
+	if _, err := canonicalizeJSON([]byte(`{"a": 1} trailing`)); err == nil {
+		t.Errorf("Expected error for trailing data after JSON")
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	invalid := []NormalizeStepType{
+		{},
+		{Sort: true, JSON: true},
+		{Delete: "("},
+		{Replace: "[", With: "x"},
+		{DropColumns: []int{0}},
+	}
+	for _, step := range invalid {
+		if _, err := (CommandType{Normalize: []NormalizeStepType{step}}).normalizer(); err == nil {
+			t.Errorf("Expected error for invalid step %+v", step)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package configsync
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isExcluded does the file path match any of the exclude patterns. Patterns without a slash match the name of the
+// file or any of its parent directories, such as '*.rpmnew'. Patterns with a slash match the full path of the file or
+// any of its parent directories, such as '/etc/ssh/ssh_host_*_key' or '/etc/**/*.bak'.
+func isExcluded(filePath string, excludePatterns []string) bool {
+	return matchesAnyPattern(filePath, excludePatterns)
+}
+
+// matchesAnyPattern does the file path match any of the patterns, following the same rules as isExcluded
+func matchesAnyPattern(filePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pathPatternMatches(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathPatternMatches(pattern, filePath string) bool {
+	filePath = path.Clean(filePath)
+	if !strings.Contains(pattern, "/") {
+		for _, component := range strings.Split(filePath, "/") {
+			if component == "" {
+				continue
+			}
+			if matched, _ := filepath.Match(pattern, component); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	pattern = strings.TrimSuffix(pattern, "/")
+	for p := filePath; p != "/" && p != "."; p = path.Dir(p) {
+		if matchDoublestar(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDoublestar does the pattern contain a recursive '**' component
+func hasDoublestar(pattern string) bool {
+	for _, component := range strings.Split(pattern, "/") {
+		if component == "**" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDoublestar check that every component of the pattern is valid
+func validateDoublestar(pattern string) error {
+	for _, component := range strings.Split(pattern, "/") {
+		if _, err := filepath.Match(component, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doublestarBase get the longest leading directory of the pattern that contains no glob characters
+func doublestarBase(pattern string) string {
+	base := []string{}
+	for _, component := range strings.Split(path.Dir(pattern), "/") {
+		if strings.ContainsAny(component, `*?[\`) {
+			break
+		}
+		base = append(base, component)
+	}
+	if len(base) == 1 && base[0] == "" {
+		return "/"
+	}
+	return strings.Join(base, "/")
+}
+
+// matchDoublestar does the file path match the pattern. A '**' component matches zero or more directories, all other
+// components follow the rules of filepath.Match.
+func matchDoublestar(pattern, filePath string) bool {
+	return matchComponents(strings.Split(pattern, "/"), strings.Split(filePath, "/"))
+}
+
+func matchComponents(pattern, components []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(components); i++ {
+				if matchComponents(pattern, components[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(components) == 0 {
+			return false
+		}
+		if matched, _ := filepath.Match(pattern[0], components[0]); !matched {
+			return false
+		}
+		pattern = pattern[1:]
+		components = components[1:]
+	}
+	return len(components) == 0
+}
@@ -0,0 +1,49 @@
+package configsync
+
+import "testing"
+
+func TestIsExcluded(t *testing.T) {
+	excludes := []string{
+		"*.rpmnew",
+		".*.swp",
+		"/etc/ssh/ssh_host_*_key",
+		"/var/cache/",
+	}
+
+	check := func(filePath string, expected bool) {
+		if result := isExcluded(filePath, excludes); result != expected {
+			t.Errorf("Unexpected result for '%s'. Expected %v got %v", filePath, expected, result)
+		}
+	}
+
+	check("/etc/yum.conf.rpmnew", true)
+	check("/etc/.fstab.swp", true)
+	check("/etc/ssh/ssh_host_rsa_key", true)
+	check("/etc/ssh/ssh_host_rsa_key.pub", false)
+	check("/var/cache/dnf/packages.db", true)
+	check("/var/cached", false)
+	check("/etc/fstab", false)
+}
+
+func TestMatchDoublestar(t *testing.T) {
+	check := func(pattern, filePath string, expected bool) {
+		if result := matchDoublestar(pattern, filePath); result != expected {
+			t.Errorf("Unexpected result for '%s' against '%s'. Expected %v got %v", filePath, pattern, expected, result)
+		}
+	}
+
+	check("/etc/nginx/**/*.conf", "/etc/nginx/nginx.conf", true)
+	check("/etc/nginx/**/*.conf", "/etc/nginx/conf.d/site.conf", true)
+	check("/etc/nginx/**/*.conf", "/etc/nginx/sites/a/b/site.conf", true)
+	check("/etc/nginx/**/*.conf", "/etc/nginx/mime.types", false)
+	check("/etc/nginx/**", "/etc/nginx/a/b/c", true)
+	check("/etc/**/ssh/*_config", "/etc/ssh/sshd_config", true)
+	check("/etc/*.conf", "/etc/a/b.conf", false)
+
+	if base := doublestarBase("/etc/nginx/**/*.conf"); base != "/etc/nginx" {
+		t.Errorf("Unexpected base. Expected '/etc/nginx' got '%s'", base)
+	}
+	if base := doublestarBase("/**/*.conf"); base != "/" {
+		t.Errorf("Unexpected base. Expected '/' got '%s'", base)
+	}
+}
@@ -0,0 +1,286 @@
+package configsync
+
+import (
+	"context"
+	"os"
+	"path"
+	"syscall"
+)
+
+// PlanType describes the changes that a sync would make to the work directory
+type PlanType struct {
+	// Paths of files that are not yet synced and would be copied into the work directory
+	Add []string
+	// Paths of files that are synced and have changed since the last sync
+	Modify []string
+	// Paths of files that are synced and have not changed since the last sync
+	Unchanged []string
+	// Paths of files or command outputs that would be removed from the work directory
+	Remove []string
+	// Paths of command outputs that would be generated by running commands
+	Commands []string
+	// Files or patterns that could not be read
+	Failed []FailureType
+
+	files  []plannedFileT
+	remove []fileType
+}
+
+type fileAction int
+
+const (
+	fileActionAdd fileAction = iota
+	fileActionModify
+	fileActionUnchanged
+)
+
+type plannedFileT struct {
+	File   fileType
+	Action fileAction
+}
+
+// HasChanges would the sync add, modify, or remove any files. Changes to command outputs can't be known without
+// running the command.
+func (p *PlanType) HasChanges() bool {
+	return len(p.Add) > 0 || len(p.Modify) > 0 || len(p.Remove) > 0
+}
+
+// Plan determine what changes a sync would make without touching the work directory. Commands are not run.
+func Plan(ctx context.Context, options Options) (*PlanType, error) {
+	metadata := tryLoadMeta(path.Join(options.WorkDir, metadataFileName))
+	redactor, err := options.Redaction.redactor()
+	if err != nil {
+		return nil, err
+	}
+	encrypter, err := options.Encryption.encrypter()
+	if err != nil {
+		return nil, err
+	}
+	return buildPlan(ctx, options, metadata, redactor, encrypter)
+}
+
+func buildPlan(ctx context.Context, options Options, metadata *metadataType, redactor *redactorT, encrypter *encrypterT) (*PlanType, error) {
+	plan := &PlanType{}
+	workDir := options.WorkDir
+
+	commandFileMap := map[string]bool{}
+	for _, command := range options.Commands {
+		for _, filePath := range command.outputFilePaths() {
+			commandFileMap[filePath] = true
+		}
+	}
+	fileMap := map[string]bool{}
+	for _, pattern := range options.FilePatterns {
+		fileMap[pattern] = true
+	}
+
+	existingFiles := map[string]fileType{}
+	for _, file := range metadata.Files {
+		syncPath := path.Join(workDir, file.Path)
+		shouldRemove := false
+		if file.Source == fileSourceCommand {
+			if !commandFileMap[file.Path] {
+				log.Warn("Will remove command output '%s' ('%s') because it was removed from the config", file.Path, syncPath)
+				shouldRemove = true
+			}
+		} else {
+			if !fileMap[file.Source] {
+				log.Warn("Will remove file '%s' ('%s') because it was removed from the config", file.Path, syncPath)
+				shouldRemove = true
+			}
+			if !fileExists(file.Path) {
+				log.Warn("Will remove file '%s' ('%s') because the source no longer exists", file.Path, syncPath)
+				shouldRemove = true
+			}
+			if isExcluded(file.Path, options.ExcludePatterns) {
+				log.Warn("Will remove file '%s' ('%s') because it is excluded", file.Path, syncPath)
+				shouldRemove = true
+			}
+		}
+		if shouldRemove {
+			plan.remove = append(plan.remove, file)
+			plan.Remove = append(plan.Remove, file.Path)
+		} else {
+			existingFiles[file.Path] = file
+		}
+	}
+
+	for _, fileToBackup := range expandFilePatterns(options.FilePatterns, options.ExcludePatterns, options.Walk, plan) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		file, err := statFile(fileToBackup, redactor, encrypter)
+		if err != nil {
+			plan.fail(fileToBackup.FilePath, err)
+			continue
+		}
+
+		action := fileActionAdd
+		syncPath := path.Join(workDir, fileToBackup.FilePath)
+		existing, isSynced := existingFiles[file.Path]
+		if isSynced || fileExists(syncPath) {
+			action = fileActionModify
+			if isSynced && existing.Hash == file.Hash && existing.Encrypted == file.Encrypted && fileExists(syncPath) {
+				action = fileActionUnchanged
+			}
+		}
+
+		switch action {
+		case fileActionAdd:
+			plan.Add = append(plan.Add, file.Path)
+		case fileActionModify:
+			plan.Modify = append(plan.Modify, file.Path)
+		case fileActionUnchanged:
+			plan.Unchanged = append(plan.Unchanged, file.Path)
+		}
+		plan.files = append(plan.files, plannedFileT{
+			File:   *file,
+			Action: action,
+		})
+	}
+
+	for _, command := range options.Commands {
+		plan.Commands = append(plan.Commands, command.FilePath)
+	}
+
+	return plan, nil
+}
+
+func (p *PlanType) fail(filePath string, err error) {
+	p.Failed = append(p.Failed, FailureType{
+		Path:  filePath,
+		Error: err,
+	})
+}
+
+// expandFilePatterns expand all globs and directories in the given file patterns, skipping anything that matches an
+// exclude pattern. Patterns that can't be expanded are recorded as failures on the plan.
+func expandFilePatterns(filePatterns []string, excludePatterns []string, walkOptions WalkOptionsType, plan *PlanType) []fileToBackupT {
+	filesToBackup := []fileToBackupT{}
+	for _, pattern := range filePatterns {
+		if isExcluded(pattern, excludePatterns) {
+			log.Info("Skipping excluded pattern '%s'", pattern)
+			continue
+		}
+		if fileExists(pattern) {
+			filesToBackup = append(filesToBackup, fileToBackupT{
+				FilePath: pattern,
+				Source:   pattern,
+			})
+			continue
+		}
+
+		paths, err := globFiles(pattern, walkOptions, excludePatterns)
+		if err != nil {
+			log.Error("Invalid glob pattern '%s'", pattern)
+			plan.fail(pattern, err)
+			continue
+		}
+		if len(paths) == 0 {
+			log.Warn("No files matched glob '%s'", pattern)
+			continue
+		}
+		log.Info("Expanding glob '%s' to -> %v", pattern, paths)
+		for _, globPath := range paths {
+			if isExcluded(globPath, excludePatterns) {
+				log.Debug("Skipping excluded path '%s'", globPath)
+				continue
+			}
+			info, err := os.Stat(globPath)
+			if err != nil {
+				log.PError("Error querying path from glob", map[string]interface{}{
+					"path":  globPath,
+					"error": err.Error(),
+					"glob":  pattern,
+				})
+				plan.fail(globPath, err)
+				continue
+			}
+			if info.IsDir() {
+				files, err := listAllFilesInDirectory(globPath, walkOptions, excludePatterns)
+				if err != nil {
+					log.PError("Error listing files in directory", map[string]interface{}{
+						"path":  globPath,
+						"error": err.Error(),
+					})
+					plan.fail(globPath, err)
+					continue
+				}
+				log.Info("Expanding directory '%s' to -> %v", globPath, files)
+				for _, file := range files {
+					filesToBackup = append(filesToBackup, fileToBackupT{
+						FilePath: file,
+						Source:   pattern,
+					})
+				}
+			} else {
+				filesToBackup = append(filesToBackup, fileToBackupT{
+					FilePath: globPath,
+					Source:   pattern,
+				})
+			}
+		}
+	}
+
+	return filesToBackup
+}
+
+// statFile hash and stat the source file. If any secrets are redacted from the file the hash is of the redacted content.
+func statFile(fileToBackup fileToBackupT, redactor *redactorT, encrypter *encrypterT) (*fileType, error) {
+	var hash uint64
+	redacted := len(redactor.forFile(fileToBackup.FilePath)) > 0
+	encrypted := encrypter.shouldEncrypt(fileToBackup.FilePath)
+	if redacted || encrypted {
+		data, err := readSourceFile(fileToBackup.FilePath, redactor)
+		if err != nil {
+			return nil, err
+		}
+		hash = hashBytes(data)
+	} else {
+		h, err := hashFile(fileToBackup.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		hash = h
+	}
+
+	info, err := os.Stat(fileToBackup.FilePath)
+	if err != nil {
+		log.Error("Error stat-ing file: %s", err.Error())
+		return nil, err
+	}
+
+	var UID int
+	var GID int
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		UID = int(stat.Uid)
+		GID = int(stat.Gid)
+	}
+
+	return &fileType{
+		Path: fileToBackup.FilePath,
+		Hash: hash,
+		Info: fileInfoType{
+			Mode: uint32(info.Mode()),
+			UID:  UID,
+			GID:  GID,
+		},
+		Source:    fileToBackup.Source,
+		Redacted:  redacted,
+		Encrypted: encrypted,
+	}, nil
+}
+
+// readSourceFile read the contents of the source file, redacting any secrets
+func readSourceFile(filePath string, redactor *redactorT) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		log.PError("Error reading source file", map[string]interface{}{
+			"path":  filePath,
+			"error": err.Error(),
+		})
+		return nil, err
+	}
+	return redactor.redact(data, redactor.forFile(filePath)), nil
+}
@@ -0,0 +1,146 @@
+package configsync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+// RedactionOptionsType describes the options for redacting secrets from synced files and command outputs
+type RedactionOptionsType struct {
+	// The key used to hash redacted secrets. Required if any rules are defined.
+	Key []byte
+	// The redaction rules
+	Rules []RedactionRuleType
+}
+
+// RedactionRuleType describes a set of patterns to redact from matching files and command outputs
+type RedactionRuleType struct {
+	// Glob patterns of files this rule applies to. Follows the same matching rules as exclude patterns.
+	Files []string `toml:"files"`
+	// File paths of command outputs this rule applies to
+	Commands []string `toml:"commands"`
+	// Regular expressions of secrets to redact. If the expression has capture groups then only the captured text is
+	// redacted, otherwise the entire match is redacted.
+	Patterns []string `toml:"patterns"`
+}
+
+// redactedPlaceholderLength is the number of hex characters of the keyed hash included in the placeholder
+const redactedPlaceholderLength = 16
+
+type redactionRuleT struct {
+	Files    []string
+	Commands map[string]bool
+	Patterns []*regexp.Regexp
+}
+
+type redactorT struct {
+	key   []byte
+	rules []redactionRuleT
+}
+
+// redactor compile the redaction rules. Returns nil if there are no rules.
+func (o RedactionOptionsType) redactor() (*redactorT, error) {
+	if len(o.Rules) == 0 {
+		return nil, nil
+	}
+	if len(o.Key) == 0 {
+		return nil, fmt.Errorf("a redaction key is required to use redaction rules")
+	}
+
+	r := &redactorT{key: o.Key}
+	for _, rule := range o.Rules {
+		compiled := redactionRuleT{
+			Files:    rule.Files,
+			Commands: map[string]bool{},
+		}
+		for _, command := range rule.Commands {
+			compiled.Commands[command] = true
+		}
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction pattern '%s': %s", pattern, err.Error())
+			}
+			compiled.Patterns = append(compiled.Patterns, re)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// forFile get the patterns that apply to the file
+func (r *redactorT) forFile(filePath string) []*regexp.Regexp {
+	if r == nil {
+		return nil
+	}
+	patterns := []*regexp.Regexp{}
+	for _, rule := range r.rules {
+		if matchesAnyPattern(filePath, rule.Files) {
+			patterns = append(patterns, rule.Patterns...)
+		}
+	}
+	return patterns
+}
+
+// forCommand get the patterns that apply to the command output
+func (r *redactorT) forCommand(filePath string) []*regexp.Regexp {
+	if r == nil {
+		return nil
+	}
+	patterns := []*regexp.Regexp{}
+	for _, rule := range r.rules {
+		if rule.Commands[filePath] {
+			patterns = append(patterns, rule.Patterns...)
+		}
+	}
+	return patterns
+}
+
+// redact replace all secrets matched by the patterns with a placeholder containing a keyed hash of the secret
+func (r *redactorT) redact(data []byte, patterns []*regexp.Regexp) []byte {
+	for _, pattern := range patterns {
+		data = r.redactPattern(data, pattern)
+	}
+	return data
+}
+
+func (r *redactorT) redactPattern(data []byte, pattern *regexp.Regexp) []byte {
+	matches := pattern.FindAllSubmatchIndex(data, -1)
+	if len(matches) == 0 {
+		return data
+	}
+
+	out := make([]byte, 0, len(data))
+	last := 0
+	for _, match := range matches {
+		spans := [][2]int{}
+		if len(match) == 2 {
+			spans = append(spans, [2]int{match[0], match[1]})
+		}
+		for i := 2; i < len(match); i += 2 {
+			start, end := match[i], match[i+1]
+			// Skip groups that didn't participate or are nested inside an earlier group
+			if start < 0 || (len(spans) > 0 && start < spans[len(spans)-1][1]) {
+				continue
+			}
+			spans = append(spans, [2]int{start, end})
+		}
+
+		for _, span := range spans {
+			out = append(out, data[last:span[0]]...)
+			out = append(out, r.placeholder(data[span[0]:span[1]])...)
+			last = span[1]
+		}
+	}
+	out = append(out, data[last:]...)
+	return out
+}
+
+func (r *redactorT) placeholder(secret []byte) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(secret)
+	return "<redacted:" + hex.EncodeToString(mac.Sum(nil))[:redactedPlaceholderLength] + ">"
+}
@@ -0,0 +1,49 @@
+package configsync
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	redactor, err := RedactionOptionsType{
+		Key: []byte("hunter2"),
+		Rules: []RedactionRuleType{
+			{
+				Files:    []string{"*.conf"},
+				Patterns: []string{`psk="([^"]*)"`, `(?m)^password .*$`},
+			},
+		},
+	}.redactor()
+	if err != nil {
+		t.Fatalf("Unexpected error compiling rules: %s", err.Error())
+	}
+
+	patterns := redactor.forFile("/etc/wpa_supplicant/wpa_supplicant.conf")
+	if len(patterns) != 2 {
+		t.Fatalf("Unexpected number of patterns. Expected 2 got %d", len(patterns))
+	}
+	if len(redactor.forFile("/etc/passwd")) != 0 {
+		t.Errorf("Rule should not apply to unmatched file")
+	}
+
+	input := "ssid=\"home\"\npsk=\"secret1\"\npassword abc\n"
+	result := string(redactor.redact([]byte(input), patterns))
+	if strings.Contains(result, "secret1") || strings.Contains(result, "abc") {
+		t.Errorf("Secrets were not redacted: %s", result)
+	}
+	if !strings.Contains(result, "ssid=\"home\"\npsk=\"<redacted:") {
+		t.Errorf("Only the captured group should be redacted: %s", result)
+	}
+	if result != string(redactor.redact([]byte(input), patterns)) {
+		t.Errorf("Redaction should be stable")
+	}
+	changed := string(redactor.redact([]byte(strings.Replace(input, "secret1", "secret2", 1)), patterns))
+	if changed == result {
+		t.Errorf("Changing a secret should change the placeholder")
+	}
+
+	if _, err := (RedactionOptionsType{Rules: []RedactionRuleType{{Patterns: []string{"x"}}}}).redactor(); err == nil {
+		t.Errorf("Expected error without a key")
+	}
+}
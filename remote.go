@@ -0,0 +1,137 @@
+package configsync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
+const (
+	// PullStrategyRebase rebase local commits onto the remote branch. This is the default.
+	PullStrategyRebase = "rebase"
+	// PullStrategyMerge merge the remote branch into the local branch
+	PullStrategyMerge = "merge"
+)
+
+// defaultPushRetries is how many times a rejected push is retried if not specified
+const defaultPushRetries = 3
+
+// ErrDiverged is returned when the local branch has diverged from the remote branch and the changes could not be
+// integrated automatically
+var ErrDiverged = errors.New("local branch has diverged from the remote branch")
+
+// ErrFetch is returned when the remote could not be fetched. The changes are still committed locally but nothing is
+// pulled or pushed.
+var ErrFetch = errors.New("error fetching from remote")
+
+func validatePullStrategy(strategy string) error {
+	switch strategy {
+	case "", PullStrategyRebase, PullStrategyMerge:
+		return nil
+	}
+	return fmt.Errorf("invalid pull strategy '%s'", strategy)
+}
+
+// pushRetries get the number of times a rejected push is retried
+func (o GitOptionsType) pushRetries() int {
+	if o.PushRetries < 0 {
+		return 0
+	}
+	if o.PushRetries == 0 {
+		return defaultPushRetries
+	}
+	return o.PushRetries
+}
+
+// integrateRemote integrate the fetched remote branch into the local branch using the pull strategy. Divergence is
+// recorded on the report. Returns ErrDiverged if the branches could not be integrated.
+func integrateRemote(g git.Repository, gitOptions GitOptionsType, report *Report) error {
+	if exists, err := g.RemoteBranchExists(gitOptions.RemoteName, gitOptions.BranchName); err != nil {
+		return fmt.Errorf("error looking up remote branch: %w", err)
+	} else if !exists {
+		return nil
+	}
+	upstream := gitOptions.RemoteName + "/" + gitOptions.BranchName
+	ahead, behind, err := g.Divergence("HEAD", upstream)
+	if err != nil {
+		return fmt.Errorf("error comparing with remote branch: %s", err.Error())
+	}
+	if behind == 0 {
+		return nil
+	}
+	if ahead > 0 {
+		report.Diverged = true
+		log.PWarn("Local branch has diverged from remote branch", map[string]interface{}{
+			"branch":         gitOptions.BranchName,
+			"upstream":       upstream,
+			"local_commits":  ahead,
+			"remote_commits": behind,
+			"strategy":       gitOptions.PullStrategy,
+		})
+	}
+
+	if gitOptions.PullStrategy == PullStrategyMerge {
+		err = g.Merge(upstream, gitOptions.Author)
+	} else {
+		err = g.Rebase(upstream, gitOptions.Author)
+	}
+	if err != nil {
+		report.Diverged = true
+		log.PError("Error integrating remote branch", map[string]interface{}{
+			"upstream": upstream,
+			"error":    err.Error(),
+		})
+		return fmt.Errorf("%w: %d local and %d remote commits could not be integrated from '%s': %w", ErrDiverged, ahead, behind, upstream, err)
+	}
+	log.Info("Integrated %d commits from '%s'", behind, upstream)
+	return nil
+}
+
+// hasUnpushedCommits does the local branch have commits that are not on the remote branch. If that can't be determined
+// a push is attempted so that the error is reported.
+func hasUnpushedCommits(g git.Repository, gitOptions GitOptionsType) bool {
+	if exists, err := g.RemoteBranchExists(gitOptions.RemoteName, gitOptions.BranchName); err != nil {
+		return true
+	} else if !exists {
+		_, err := g.HeadCommit()
+		return err == nil
+	}
+	ahead, _, err := g.Divergence("HEAD", gitOptions.RemoteName+"/"+gitOptions.BranchName)
+	if err != nil {
+		return true
+	}
+	return ahead > 0
+}
+
+// pushRemote push the local branch to the remote. If the remote has moved, the remote branch is fetched, integrated,
+// and the push is retried.
+func pushRemote(g git.Repository, gitOptions GitOptionsType, report *Report) error {
+	for attempt := 0; ; attempt++ {
+		err := g.Push(gitOptions.RemoteName, gitOptions.BranchName)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, git.ErrNonFastForward) || attempt >= gitOptions.pushRetries() {
+			return fmt.Errorf("error pushing to remote: %w", err)
+		}
+
+		log.Warn("Push to remote '%s' was rejected, retrying (%d/%d)", gitOptions.RemoteName, attempt+1, gitOptions.pushRetries())
+		if err := g.Fetch(gitOptions.RemoteName); err != nil {
+			return fmt.Errorf("error fetching from remote: %s", err.Error())
+		}
+		if err := integrateRemote(g, gitOptions, report); err != nil {
+			return err
+		}
+		if gitOptions.PullStrategy != PullStrategyMerge && len(report.Commits) > 0 {
+			// Rebasing rewrites the commits that were made
+			commits, err := g.RevList("HEAD", len(report.Commits))
+			if err != nil {
+				log.Error("Error getting commit hashes: %s", err.Error())
+			} else {
+				report.Commits = commits
+				report.CommitHash = commits[len(commits)-1]
+			}
+		}
+	}
+}
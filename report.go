@@ -0,0 +1,87 @@
+package configsync
+
+import "time"
+
+// Report describes the outcome of a sync
+type Report struct {
+	// Paths of files or command outputs that were not previously synced
+	Added []string
+	// Paths of files or command outputs that were previously synced and have changed
+	Updated []string
+	// Paths of files or command outputs that were previously synced and have not changed
+	Unchanged []string
+	// Paths of files or command outputs that were removed from the work directory
+	Removed []string
+	// Files or command outputs that could not be synced
+	Failed []FailureType
+	// Commands that were run
+	Commands []CommandResultType
+	// If a commit was made
+	Committed bool
+	// The hash of the commit, if one was made. If multiple commits were made this is the last one.
+	CommitHash string
+	// The hashes of all commits that were made, in order
+	Commits []string
+	// If the commit was pushed to the remote
+	Pushed bool
+	// The name of the tag that was made, if any
+	Tag string
+	// If the local branch had diverged from the remote branch
+	Diverged bool
+	// The error fetching from the remote, if any. Nothing is pulled or pushed if the fetch fails.
+	FetchError error
+	// The error that kept the changes from being pushed, if any. This is either the error integrating the remote
+	// branch or the error pushing to the remote. The changes are still committed and tagged locally.
+	PushError error
+	// How long the sync took
+	Duration time.Duration
+}
+
+// FailureType describes a file or command output that could not be synced
+type FailureType struct {
+	Path  string
+	Error error
+}
+
+// CommandResultType describes the outcome of a single command
+type CommandResultType struct {
+	FilePath  string
+	ExePath   string
+	Arguments []string
+	Shell     string
+	Error     error
+	// If the command was killed because it exceeded its timeout
+	TimedOut bool
+	// The exit status of the command, or -1 if it could not be run
+	ExitCode int
+	// How long the command ran for
+	Duration time.Duration
+}
+
+// Success did the command run successfully
+func (c CommandResultType) Success() bool {
+	return c.Error == nil
+}
+
+// HasFailures did any file or command fail to sync
+func (r *Report) HasFailures() bool {
+	return len(r.Failed) > 0
+}
+
+func (r *Report) fail(filePath string, err error) {
+	r.Failed = append(r.Failed, FailureType{
+		Path:  filePath,
+		Error: err,
+	})
+}
+
+func (r *Report) addStatus(filePath string, status syncStatus) {
+	switch status {
+	case syncStatusAdded:
+		r.Added = append(r.Added, filePath)
+	case syncStatusUpdated:
+		r.Updated = append(r.Updated, filePath)
+	case syncStatusUnchanged:
+		r.Unchanged = append(r.Unchanged, filePath)
+	}
+}
@@ -0,0 +1,263 @@
+package configsync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
+// RestoreOptions describes the options for restoring synced files back onto the system
+type RestoreOptions struct {
+	// The git working directory where synced files are saved
+	WorkDir string
+	// Git options
+	Git GitOptionsType
+	// Absolute paths of files or directories to restore. If empty, all synced files are restored.
+	Paths []string
+	// The revision (commit hash, branch, or tag) to restore from. If empty, files are restored from the work directory.
+	Revision string
+	// Optional alternate root directory to restore files into, such as '/mnt/sysimage'
+	Root string
+	// If true then existing files that would be overwritten are not backed up
+	NoBackup bool
+	// The key used to decrypt encrypted files. Required to restore encrypted files.
+	EncryptionKey []byte
+}
+
+// RestoreReport describes the outcome of a restore
+type RestoreReport struct {
+	// Paths of files that were written to the system
+	Restored []string
+	// Paths of files that already matched and only had their permissions applied
+	Unchanged []string
+	// Paths of backups made of files that were overwritten
+	Backups []string
+	// Files that could not be restored
+	Failed []FailureType
+	// If signature verification is set to warn, the reason the commit being restored from could not be verified
+	SignatureWarning error
+}
+
+func (r *RestoreReport) fail(filePath string, err error) {
+	r.Failed = append(r.Failed, FailureType{
+		Path:  filePath,
+		Error: err,
+	})
+}
+
+// Restore write synced files back to their original location on the system, applying the recorded mode and ownership.
+// Command outputs and files with redacted secrets can not be restored.
+func Restore(ctx context.Context, options RestoreOptions) (*RestoreReport, error) {
+	report := &RestoreReport{}
+
+	encrypter, err := EncryptionOptionsType{Key: options.EncryptionKey}.encrypter()
+	if err != nil {
+		return nil, err
+	}
+
+	var g git.Repository
+	if options.Revision != "" || options.Git.verifySignatures() {
+		instance, err := options.Git.openGit(options.WorkDir, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error opening git instance: %s", err.Error())
+		}
+		g = instance
+	}
+
+	revision := options.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+	verifyErr := options.Git.verifyCommit(g, revision)
+	if verifyErr == nil && options.Revision == "" && options.Git.verifySignatures() {
+		dirty, err := g.HasChanges()
+		if err != nil {
+			return nil, fmt.Errorf("error getting git status: %s", err.Error())
+		}
+		if dirty {
+			verifyErr = fmt.Errorf("work directory has uncommitted changes")
+		}
+	}
+	if verifyErr != nil {
+		if options.Git.VerifySignatures == SignatureVerifyRequire {
+			log.Error("Refusing to restore: %s", verifyErr.Error())
+			return nil, fmt.Errorf("refusing to restore: %w", verifyErr)
+		}
+		log.Warn("Restoring from unverified commit: %s", verifyErr.Error())
+		report.SignatureWarning = verifyErr
+	}
+
+	var metadata *metadataType
+	if options.Revision == "" {
+		metadataPath := path.Join(options.WorkDir, metadataFileName)
+		if !fileExists(metadataPath) {
+			return nil, fmt.Errorf("no metadata found in work directory '%s'", options.WorkDir)
+		}
+		metadata = tryLoadMeta(metadataPath)
+	} else {
+		m, err := loadMetaAtRevision(g, options.Revision)
+		if err != nil {
+			return nil, err
+		}
+		metadata = m
+	}
+
+	files := []fileType{}
+	matched := map[string]bool{}
+	for _, file := range metadata.Files {
+		if len(options.Paths) == 0 {
+			if file.Source == fileSourceCommand {
+				continue
+			}
+			if file.Redacted {
+				report.fail(file.Path, fmt.Errorf("files with redacted secrets can not be restored"))
+				continue
+			}
+			files = append(files, file)
+			continue
+		}
+		for _, restorePath := range options.Paths {
+			if !pathContains(restorePath, file.Path) {
+				continue
+			}
+			matched[restorePath] = true
+			if file.Source == fileSourceCommand {
+				report.fail(file.Path, fmt.Errorf("command outputs can not be restored"))
+				break
+			}
+			if file.Redacted {
+				report.fail(file.Path, fmt.Errorf("files with redacted secrets can not be restored"))
+				break
+			}
+			files = append(files, file)
+			break
+		}
+	}
+	for _, restorePath := range options.Paths {
+		if !matched[restorePath] {
+			report.fail(restorePath, fmt.Errorf("path is not synced"))
+		}
+	}
+
+	backupSuffix := ".configsync-" + time.Now().Format("20060102150405")
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var data []byte
+		if options.Revision != "" {
+			data, err = g.ShowFile(options.Revision, file.Path)
+		} else {
+			data, err = os.ReadFile(path.Join(options.WorkDir, file.Path))
+		}
+		if err != nil {
+			log.PError("Error reading synced file", map[string]interface{}{
+				"path":     file.Path,
+				"revision": options.Revision,
+				"error":    err.Error(),
+			})
+			report.fail(file.Path, err)
+			continue
+		}
+		if file.Encrypted {
+			data, err = encrypter.decrypt(file.Path, data)
+			if err != nil {
+				log.PError("Error decrypting synced file", map[string]interface{}{
+					"path":  file.Path,
+					"error": err.Error(),
+				})
+				report.fail(file.Path, err)
+				continue
+			}
+		}
+
+		destPath := path.Join("/", options.Root, file.Path)
+		backupPath, changed, err := restoreFile(destPath, data, file.Info, backupSuffix, !options.NoBackup)
+		if err != nil {
+			log.PError("Error restoring file", map[string]interface{}{
+				"path":  destPath,
+				"error": err.Error(),
+			})
+			report.fail(file.Path, err)
+			continue
+		}
+		if backupPath != "" {
+			report.Backups = append(report.Backups, backupPath)
+		}
+		if changed {
+			log.Info("Restored file '%s'", destPath)
+			report.Restored = append(report.Restored, file.Path)
+		} else {
+			log.Info("No changes to restored file '%s'", destPath)
+			report.Unchanged = append(report.Unchanged, file.Path)
+		}
+	}
+
+	return report, nil
+}
+
+// restoreFile atomically write data to destPath and apply the file info. If the destination already exists with
+// different contents it is backed up first. Returns the path of the backup, if one was made, and if the contents changed.
+func restoreFile(destPath string, data []byte, info fileInfoType, backupSuffix string, backup bool) (string, bool, error) {
+	if err := makeDirectoryIfNotExists(pathWithoutFile(destPath)); err != nil {
+		return "", false, err
+	}
+
+	backupPath := ""
+	if fileExists(destPath) {
+		existing, err := os.ReadFile(destPath)
+		if err != nil {
+			return "", false, err
+		}
+		if string(existing) == string(data) {
+			return "", false, applyFileInfo(destPath, info)
+		}
+		if backup {
+			backupPath = destPath + backupSuffix
+			if err := os.WriteFile(backupPath, existing, 0600); err != nil {
+				return "", false, fmt.Errorf("error backing up file: %s", err.Error())
+			}
+		}
+	}
+
+	atomicPath := destPath + "_"
+	if err := os.WriteFile(atomicPath, data, 0600); err != nil {
+		os.Remove(atomicPath)
+		return backupPath, false, err
+	}
+	if err := applyFileInfo(atomicPath, info); err != nil {
+		os.Remove(atomicPath)
+		return backupPath, false, err
+	}
+	if err := os.Rename(atomicPath, destPath); err != nil {
+		os.Remove(atomicPath)
+		return backupPath, false, err
+	}
+
+	return backupPath, true, nil
+}
+
+func applyFileInfo(filePath string, info fileInfoType) error {
+	if err := os.Chown(filePath, info.UID, info.GID); err != nil {
+		return fmt.Errorf("error setting ownership: %s", err.Error())
+	}
+	if err := os.Chmod(filePath, os.FileMode(info.Mode)); err != nil {
+		return fmt.Errorf("error setting mode: %s", err.Error())
+	}
+	return nil
+}
+
+// pathContains is filePath equal to or a child of parent
+func pathContains(parent, filePath string) bool {
+	parent = path.Clean(parent)
+	if parent == filePath || parent == "/" {
+		return true
+	}
+	return strings.HasPrefix(filePath, parent+"/")
+}
@@ -0,0 +1,109 @@
+package configsync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
+const (
+	// SignatureVerifyNone commit signatures are not verified. This is the default.
+	SignatureVerifyNone = "none"
+	// SignatureVerifyWarn commits that are unsigned or have a bad signature are reported, but still used
+	SignatureVerifyWarn = "warn"
+	// SignatureVerifyRequire commits that are unsigned or have a bad signature are refused
+	SignatureVerifyRequire = "require"
+)
+
+// verifySignatures should commit signatures be verified
+func (o GitOptionsType) verifySignatures() bool {
+	return o.VerifySignatures == SignatureVerifyWarn || o.VerifySignatures == SignatureVerifyRequire
+}
+
+// verifyCommit verify the signature of the commit at revision, if verification is enabled
+func (o GitOptionsType) verifyCommit(g git.Repository, revision string) error {
+	if !o.verifySignatures() {
+		return nil
+	}
+	signer, ok := g.(git.Signer)
+	if !ok {
+		return fmt.Errorf("the %s git backend does not support signatures", o.backend())
+	}
+	if err := signer.VerifyCommit(revision); err != nil {
+		return fmt.Errorf("commit '%s' can not be verified: %w", revision, err)
+	}
+	log.Info("Commit '%s' has a valid signature", revision)
+	return nil
+}
+
+// VerifyOptions describes the options for verifying the signatures of synced commits
+type VerifyOptions struct {
+	// The git working directory where synced files are saved
+	WorkDir string
+	// Git options. A signing format is required.
+	Git GitOptionsType
+	// The revision to verify, along with all of its ancestors. Defaults to the branch name or hostname of the system.
+	Revision string
+}
+
+// VerifyReport describes the signatures of synced commits
+type VerifyReport struct {
+	// The revision that was verified
+	Revision string
+	// All commits that were checked, newest first
+	Commits []CommitVerificationType
+}
+
+// CommitVerificationType describes the signature of a single commit
+type CommitVerificationType struct {
+	Hash string
+	// The signer of the commit, if known
+	Signer string
+	// The reason the signature is not valid, or nil if it is
+	Error error
+}
+
+// HasInvalid are any commits unsigned or badly signed
+func (r *VerifyReport) HasInvalid() bool {
+	for _, commit := range r.Commits {
+		if commit.Error != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify check the signature of every commit in the history of the revision
+func Verify(ctx context.Context, options VerifyOptions) (*VerifyReport, error) {
+	if options.Git.SigningFormat == "" {
+		return nil, fmt.Errorf("a signing format is required to verify signatures")
+	}
+	revision := options.Git.hostRevision(options.Revision)
+
+	g, err := options.Git.openGit(options.WorkDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error opening git instance: %s", err.Error())
+	}
+	signer, ok := g.(git.Signer)
+	if !ok {
+		return nil, fmt.Errorf("the %s git backend does not support signatures", options.Git.backend())
+	}
+	signatures, err := signer.CommitSignatures(revision, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error reading commit signatures: %s", err.Error())
+	}
+
+	report := &VerifyReport{Revision: revision}
+	for _, signature := range signatures {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.Commits = append(report.Commits, CommitVerificationType{
+			Hash:   signature.Hash,
+			Signer: signature.Signer,
+			Error:  signature.Err(),
+		})
+	}
+	return report, nil
+}
@@ -0,0 +1,143 @@
+package configsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/ecnepsnai/configsync/git"
+)
+
+// TagOptions describes the options for tagging a synced commit
+type TagOptions struct {
+	// The git working directory where synced files are saved
+	WorkDir string
+	// Git options. If the remote is enabled the tag is pushed to it.
+	Git GitOptionsType
+	// The name of the tag
+	Name string
+	// The message of the annotated tag. Defaults to the name of the tag.
+	Message string
+	// The revision (commit hash, branch, or tag) to tag. Defaults to the branch name or hostname of the system.
+	Revision string
+}
+
+// TagReport describes a tag that was created
+type TagReport struct {
+	// The name of the tag
+	Name string
+	// The hash of the commit that was tagged
+	Commit string
+	// If the tag was pushed to the remote
+	Pushed bool
+}
+
+// Tag create an annotated tag of a synced commit to mark the state of the system, such as before maintenance. If the
+// remote is enabled the tag is pushed to it. Tags can be used as the revision to restore from or compare against.
+func Tag(ctx context.Context, options TagOptions) (*TagReport, error) {
+	if options.Name == "" {
+		return nil, fmt.Errorf("a tag name is required")
+	}
+	gitOptions := options.Git
+	if gitOptions.RemoteName == "" && gitOptions.RemoteEnabled {
+		gitOptions.RemoteName = defaultRemoteName
+	}
+	message := options.Message
+	if message == "" {
+		message = options.Name
+	}
+
+	g, err := gitOptions.openGit(options.WorkDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error opening git instance: %s", err.Error())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := g.CreateTag(options.Name, gitOptions.hostRevision(options.Revision), message, gitOptions.author()); err != nil {
+		return nil, fmt.Errorf("error creating tag '%s': %w", options.Name, err)
+	}
+	log.Info("Created tag '%s'", options.Name)
+
+	report := &TagReport{Name: options.Name}
+	commits, err := g.RevList(options.Name, 1)
+	if err != nil || len(commits) == 0 {
+		return nil, fmt.Errorf("error getting tagged commit: %v", err)
+	}
+	report.Commit = commits[0]
+
+	if gitOptions.RemoteEnabled {
+		if err := g.PushTags(gitOptions.RemoteName, options.Name); err != nil {
+			return report, fmt.Errorf("error pushing tag '%s': %w", options.Name, err)
+		}
+		report.Pushed = true
+	}
+	return report, nil
+}
+
+// ListTags get all tags in the work directory, sorted by name
+func ListTags(ctx context.Context, workDir string, gitOptions GitOptionsType) ([]git.Tag, error) {
+	g, err := gitOptions.openGit(workDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error opening git instance: %s", err.Error())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tags, err := g.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("error listing tags: %s", err.Error())
+	}
+	return tags, nil
+}
+
+// syncTagTemplate parse the template for the name of the tag made by a sync. Returns nil if no tag should be made.
+func syncTagTemplate(options Options) (*template.Template, error) {
+	text := options.Tag
+	if text == "" {
+		text = options.Git.TagTemplate
+	}
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("tag").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag template: %s", err.Error())
+	}
+	return tmpl, nil
+}
+
+// tagSync create the tag of the synced commit and push it, if the branch was pushed
+func tagSync(g git.Repository, gitOptions GitOptionsType, tmpl *template.Template, data CommitMessageDataType, report *Report) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("error rendering tag name: %s", err.Error())
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return fmt.Errorf("tag template produced an empty name")
+	}
+	message := data.Reason
+	if message == "" {
+		message = name
+	}
+
+	if err := g.CreateTag(name, "HEAD", message, gitOptions.Author); err != nil {
+		log.PError("Error creating tag", map[string]interface{}{
+			"tag":   name,
+			"error": err.Error(),
+		})
+		return fmt.Errorf("error creating tag '%s': %w", name, err)
+	}
+	log.Info("Created tag '%s'", name)
+	report.Tag = name
+
+	if gitOptions.RemoteEnabled && report.FetchError == nil && report.PushError == nil {
+		if err := g.PushTags(gitOptions.RemoteName, name); err != nil {
+			return fmt.Errorf("error pushing tag '%s': %w", name, err)
+		}
+	}
+	return nil
+}
@@ -4,10 +4,12 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/cespare/xxhash/v2"
+	"github.com/ecnepsnai/configsync/git"
 )
 
 func directoryExists(dirPath string) bool {
@@ -39,6 +41,11 @@ func getHostname() string {
 	return hostname
 }
 
+// defaultBranchName get the branch used when none is configured, the hostname of the system made safe for git
+func defaultBranchName() string {
+	return git.SanitizeBranchName(getHostname())
+}
+
 func hashFile(filePath string) (uint64, error) {
 	w := xxhash.New()
 	f, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
@@ -60,19 +67,103 @@ func hashFile(filePath string) (uint64, error) {
 	return w.Sum64(), nil
 }
 
+func hashBytes(data []byte) uint64 {
+	return xxhash.Sum64(data)
+}
+
 func pathWithoutFile(filePath string) string {
 	components := strings.Split(filePath, "/")
 	return strings.Join(components[0:len(components)-1], "/")
 }
 
-func listAllFilesInDirectory(dir string) ([]string, error) {
+// listAllFilesInDirectory recursively list all files in dir, skipping anything that matches an exclude pattern
+func listAllFilesInDirectory(dir string, walkOptions WalkOptionsType, excludePatterns []string) ([]string, error) {
 	paths := []string{}
+	visited := map[string]bool{}
+	if realDir, err := filepath.EvalSymlinks(dir); err == nil {
+		visited[realDir] = true
+	}
 
-	err := filepath.WalkDir(dir, func(pathName string, d fs.DirEntry, err error) error {
-		if !d.IsDir() {
-			paths = append(paths, pathName)
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			pathName := path.Join(dir, entry.Name())
+			if walkOptions.SkipHidden && strings.HasPrefix(entry.Name(), ".") {
+				log.Debug("Skipping hidden path '%s'", pathName)
+				continue
+			}
+			if isExcluded(pathName, excludePatterns) {
+				log.Debug("Skipping excluded path '%s'", pathName)
+				continue
+			}
+
+			isDir := entry.IsDir()
+			if entry.Type()&fs.ModeSymlink != 0 {
+				info, err := os.Stat(pathName)
+				if err != nil {
+					log.Warn("Skipping broken symlink '%s': %s", pathName, err.Error())
+					continue
+				}
+				if info.IsDir() {
+					if !walkOptions.FollowSymlinks {
+						log.Debug("Skipping symlink to directory '%s'", pathName)
+						continue
+					}
+					realPath, err := filepath.EvalSymlinks(pathName)
+					if err != nil || visited[realPath] {
+						log.Debug("Skipping already visited directory '%s'", pathName)
+						continue
+					}
+					visited[realPath] = true
+					isDir = true
+				}
+			}
+
+			if !isDir {
+				paths = append(paths, pathName)
+				continue
+			}
+			if walkOptions.MaxDepth > 0 && depth >= walkOptions.MaxDepth {
+				continue
+			}
+			if err := walk(pathName, depth+1); err != nil {
+				log.Warn("Error reading '%s': %s", pathName, err.Error())
+			}
 		}
 		return nil
-	})
+	}
+
+	err := walk(dir, 1)
 	return paths, err
 }
+
+// globFiles expand the glob pattern. Patterns with a '**' component walk the directory tree and only match files.
+func globFiles(pattern string, walkOptions WalkOptionsType, excludePatterns []string) ([]string, error) {
+	if !hasDoublestar(pattern) {
+		return filepath.Glob(pattern)
+	}
+	if err := validateDoublestar(pattern); err != nil {
+		return nil, err
+	}
+
+	base := doublestarBase(pattern)
+	if !directoryExists(base) {
+		return nil, nil
+	}
+	files, err := listAllFilesInDirectory(base, walkOptions, excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, file := range files {
+		if matchDoublestar(pattern, file) {
+			paths = append(paths, file)
+		}
+	}
+	return paths, nil
+}
@@ -26,7 +26,7 @@ func TestListAllFilesInDirectory(t *testing.T) {
 	os.WriteFile(path.Join(dir, "1", "2", "3", "4", "file.txt"), []byte("hello"), 0644)
 	os.WriteFile(path.Join(dir, "1", "2", "3", "4", "5", "file.txt"), []byte("hello"), 0644)
 
-	files, err := listAllFilesInDirectory(dir)
+	files, err := listAllFilesInDirectory(dir, WalkOptionsType{}, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -35,3 +35,75 @@ func TestListAllFilesInDirectory(t *testing.T) {
 		t.Errorf("Incorrect number of files returned. Expected 5 got %d", len(files))
 	}
 }
+
+func TestListAllFilesInDirectoryExcludes(t *testing.T) {
+	dir := t.TempDir()
+
+	os.MkdirAll(path.Join(dir, "cache"), 0755)
+	os.WriteFile(path.Join(dir, "file.txt"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, "file.txt.rpmnew"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, "cache", "file.txt"), []byte("hello"), 0644)
+
+	files, err := listAllFilesInDirectory(dir, WalkOptionsType{}, []string{"*.rpmnew", path.Join(dir, "cache")})
+	if err != nil {
+		panic(err)
+	}
+
+	if len(files) != 1 || files[0] != path.Join(dir, "file.txt") {
+		t.Errorf("Unexpected files returned: %v", files)
+	}
+}
+
+func TestListAllFilesInDirectoryWalkOptions(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+
+	os.MkdirAll(path.Join(dir, "1", "2"), 0755)
+	os.MkdirAll(path.Join(dir, ".hidden"), 0755)
+	os.WriteFile(path.Join(dir, "file.txt"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, ".file.txt"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, ".hidden", "file.txt"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, "1", "file.txt"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, "1", "2", "file.txt"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(other, "file.txt"), []byte("hello"), 0644)
+	os.Symlink(other, path.Join(dir, "link"))
+	os.Symlink(dir, path.Join(dir, "loop"))
+
+	check := func(options WalkOptionsType, expected int) {
+		files, err := listAllFilesInDirectory(dir, options, nil)
+		if err != nil {
+			panic(err)
+		}
+		if len(files) != expected {
+			t.Errorf("Incorrect number of files returned for %+v. Expected %d got %d: %v", options, expected, len(files), files)
+		}
+	}
+
+	check(WalkOptionsType{}, 5)
+	check(WalkOptionsType{MaxDepth: 1}, 2)
+	check(WalkOptionsType{MaxDepth: 2}, 4)
+	check(WalkOptionsType{SkipHidden: true}, 3)
+	check(WalkOptionsType{FollowSymlinks: true}, 6)
+}
+
+func TestGlobFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	os.MkdirAll(path.Join(dir, "conf.d", "sites"), 0755)
+	os.WriteFile(path.Join(dir, "nginx.conf"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, "mime.types"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, "conf.d", "default.conf"), []byte("hello"), 0644)
+	os.WriteFile(path.Join(dir, "conf.d", "sites", "example.conf"), []byte("hello"), 0644)
+
+	files, err := globFiles(path.Join(dir, "**", "*.conf"), WalkOptionsType{}, nil)
+	if err != nil {
+		panic(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("Incorrect number of files returned. Expected 3 got %d: %v", len(files), files)
+	}
+
+	if _, err := globFiles(path.Join(dir, "**", "[.conf"), WalkOptionsType{}, nil); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+}